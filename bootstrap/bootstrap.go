@@ -2,15 +2,15 @@ package bootstrap
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"os"
 	"strings"
 
-	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 	apiv1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -22,217 +22,211 @@ func getPodName(p *apiv1.Pod) string {
 	return strings.TrimSuffix(p.ObjectMeta.GenerateName, "-")
 }
 
-// Run Vault bootstrap
-func Run() {
-	// Create clientSet for k8s client-go
+// newK8sClientset creates a clientset for the cluster the tool runs in
+func newK8sClientset() (*kubernetes.Clientset, error) {
 	k8sConfig, err := rest.InClusterConfig()
 	if err != nil {
-		log.Error(err.Error())
-		os.Exit(1)
+		return nil, err
 	}
+	return kubernetes.NewForConfig(k8sConfig)
+}
 
-	clientsetK8s, err := kubernetes.NewForConfig(k8sConfig)
+// newDynamicClient creates a dynamic client for the cluster the tool runs in
+func newDynamicClient() (dynamic.Interface, error) {
+	k8sConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(k8sConfig)
+}
+
+// newVaultPods creates a client for every cluster member URL. The pod name
+// is the first label of the member host name.
+func newVaultPods(members []string) ([]vaultPod, error) {
+	var vaultPods []vaultPod
+	for _, member := range members {
+		var pod vaultPod
+		podFqdn, err := url.Parse(member)
+		if err != nil {
+			return nil, err
+		}
+		pod.fqdn = member
+		pod.name = strings.Split(podFqdn.Hostname(), ".")[0]
+		client, err := newVaultClient(pod.fqdn)
+		if err != nil {
+			return nil, err
+		}
+		pod.client = client
+		vaultPods = append(vaultPods, pod)
+	}
+	return vaultPods, nil
+}
+
+// loadUnsealKeys reads the unseal keys from the unseal K8s secret
+func loadUnsealKeys(ctx context.Context, clientsetK8s kubernetes.Interface) ([]string, error) {
+	unsealKeysString, err := getValuesFromK8sSecret(ctx, clientsetK8s, &vaultSecretUnseal)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(*unsealKeysString, ";"), nil
+}
+
+// Run Vault bootstrap
+func Run(ctx context.Context) {
+	if vaultBootstrapTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vaultBootstrapTimeout)
+		defer cancel()
+	}
+
+	clientsetK8s, err := newK8sClientset()
 	if err != nil {
 		log.Error(err.Error())
 		os.Exit(1)
 	}
 
-	podsList, err := clientsetK8s.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	startEvents(ctx, clientsetK8s)
+	runReport = newBootstrapReport()
+
+	err = runBootstrap(ctx, clientsetK8s)
+	// The run ctx is cancelled after a timeout or SIGTERM, exactly when the
+	// report of the failure matters most
+	reportCtx, cancelReport := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancelReport()
+	if errReport := writeReport(reportCtx, clientsetK8s, err); errReport != nil {
+		log.Warn(errReport.Error())
+	}
 	if err != nil {
 		log.Error(err.Error())
 		os.Exit(1)
 	}
+}
+
+func runBootstrap(ctx context.Context, clientsetK8s kubernetes.Interface) error {
+	podsList, err := clientsetK8s.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
 	var pdList []string
 	for _, pd := range podsList.Items {
 		pdList = append(pdList, getPodName(&pd))
 	}
 	log.Debugf("Pods list: %s", strings.Join(pdList, ";"))
 
-	// Define Vault client for Vault LB
-	clientConfigLB := vault.DefaultConfig()
-	// Skip TLS verification for initialization
-	insecureTLS := &vault.TLSConfig{
-		Insecure: true,
+	if err := loadVaultTLSFromSecret(ctx, clientsetK8s); err != nil {
+		return err
 	}
-	clientConfigLB.ConfigureTLS(insecureTLS)
 
-	clientLB, err := vault.NewClient(clientConfigLB)
+	// Define Vault client for Vault LB
+	clientLB, err := newVaultClient(vaultAddr)
 	if err != nil {
-		os.Exit(1)
+		return err
 	}
 
-	// Slice of maps containing vault pods details
-	var vaultPods []vaultPod
-	vaultMembersUrls := strings.Split(vaultClusterMembers, ",")
-	// Generate the slice from Env variable
-	for _, member := range vaultMembersUrls {
-		var pod vaultPod
-		podFqdn, _ := url.Parse(member)
-		pod.fqdn = member
-		pod.name = strings.Split(podFqdn.Hostname(), ".")[0]
-		clientConfig := &vault.Config{
-			Address: pod.fqdn,
-		}
-		clientConfig.ConfigureTLS(insecureTLS)
+	spec, err := loadSpec()
+	if err != nil {
+		return err
+	}
 
-		client, err := vault.NewClient(clientConfig)
-		if err != nil {
-			os.Exit(1)
-		}
-		pod.client = client
-		vaultPods = append(vaultPods, pod)
+	vaultPods, err := newVaultPods(spec.Members)
+	if err != nil {
+		return err
 	}
+	runReport.vaultPods = vaultPods
 	// Define main client (vault-0) which will be used for initialization
 	// When using integrated RAFT storage, the vault cluster member that is initialized
 	// needs to be first one which is unsealed
 	// In the unseal part we'll always start with the first member
 	vaultFirstPod := vaultPods[0]
-	preflight(vaultPods)
+	statuses, err := preflight(ctx, vaultPods)
+	if err != nil {
+		return err
+	}
 
 	var rootToken *string
 	var unsealKeys *[]string
 
-	pVaultSecretRoot := &vaultSecretRoot
-	pVaultSecretUnseal := &vaultSecretUnseal
-
 	if vaultInit {
-		init, err := checkInit(vaultFirstPod)
-		if err != nil {
-			log.Errorf(err.Error())
-			os.Exit(1)
-		}
-		if !init {
-			rootToken, unsealKeys, err = operatorInit(vaultFirstPod)
+		if !statuses[vaultFirstPod.name].initialized {
+			rootToken, unsealKeys, err = operatorInit(ctx, vaultFirstPod, spec.KeyShares, spec.KeyThreshold)
 			if err != nil {
-				log.Error(err.Error())
-				os.Exit(1)
+				return err
 			}
 			// If flag for creating k8s secrets is set
 			if vaultK8sSecret {
-				// Check if vault secret root exists
-				_, err = getValuesFromK8sSecret(clientsetK8s, pVaultSecretRoot)
-				if err != nil {
-					// if it fails because secret is not found, create the secret
-					if errors.IsNotFound(err) {
-						if errI := createK8sSecret(clientsetK8s, &vaultSecretRoot, rootToken); errI != nil {
-							log.Error(errI.Error())
-							os.Exit(1)
-						}
-					} else {
-						log.Error(err.Error())
-						os.Exit(1)
-					}
-				}
-				// Check if vault secret unseal exists
-				_, err = getValuesFromK8sSecret(clientsetK8s, pVaultSecretUnseal)
-				if err != nil {
-					// if it fails because secret is not found, create the secret
-					if errors.IsNotFound(err) {
-						unsealKeysString := strings.Join(*unsealKeys, ";")
-						if errI := createK8sSecret(clientsetK8s, &vaultSecretUnseal, &unsealKeysString); errI != nil {
-							log.Error(errI.Error())
-							os.Exit(1)
-						}
-					} else {
-						log.Error(err.Error())
-						os.Exit(1)
-					}
+				if err := storeInitSecrets(ctx, clientsetK8s, rootToken, unsealKeys); err != nil {
+					return err
 				}
 			} else {
 				logTokens(rootToken, unsealKeys)
 			}
 		} else {
 			log.Info("Vault already initialized")
+			runReport.addStep(reasonInitialized, vaultFirstPod.name, stepSkipped, "Vault already initialized")
 		}
 	}
 
 	if vaultUnseal {
 		// Check if unseal keys in memory and if not load them
 		if unsealKeys == nil {
-			unsealKeysString, err := getValuesFromK8sSecret(clientsetK8s, pVaultSecretUnseal)
+			npUnsealKeys, err := loadUnsealKeys(ctx, clientsetK8s)
 			if err != nil {
-				panic("Cannot load Unseal Keys")
+				return fmt.Errorf("cannot load unseal keys: %w", err)
 			}
-			npUnsealKeys := strings.Split(*unsealKeysString, ";")
 			unsealKeys = &npUnsealKeys
 			log.Debug("Unseal Keys loaded successfully")
 		}
 		// Unseal first member first
-		unsealMember(vaultFirstPod, *unsealKeys)
-		for _, vaultPod := range vaultPods[1:] {
-			if err := operatorRaftJoin(vaultPod, vaultFirstPod); err != nil {
-				log.Error(err.Error())
-				os.Exit(1)
-			}
-			unsealMember(vaultPod, *unsealKeys)
+		if _, err := unsealMember(ctx, vaultFirstPod, *unsealKeys); err != nil {
+			return err
+		}
+		// Followers can join and unseal concurrently once the leader is up
+		if err := joinAndUnsealFollowers(ctx, vaultFirstPod, vaultPods[1:], statuses, *unsealKeys); err != nil {
+			return err
 		}
 	}
 
 	if vaultK8sAuth {
 		// Check if root token in memory and if not load it
 		if rootToken == nil {
-			pRootToken, err := getValuesFromK8sSecret(clientsetK8s, pVaultSecretRoot)
+			rootTokenVal, err := loadRootToken(ctx, clientsetK8s)
 			if err != nil {
-				panic("Cannot load Root Token")
+				return fmt.Errorf("cannot load root token: %w", err)
 			}
-			rootTokenVal := *pRootToken
 			rootToken = &rootTokenVal
 			log.Debug("Root Token loaded successfully")
 		}
 
-		up := checkVaultUp(clientLB)
-		if !up {
-			panic("k8s auth: Vault not ready. Cannot proceed")
+		if err := checkVaultUp(ctx, clientLB); err != nil {
+			return fmt.Errorf("k8s auth: Vault not ready, cannot proceed: %w", err)
 		}
 
-		// enable k8s auth
 		clientLB.SetToken(*rootToken)
-		k8sAuth, err := checkK8sAuth(clientLB)
-		if err != nil {
-			log.Errorf(err.Error())
-			os.Exit(1)
-		}
-		if !k8sAuth {
-			if err := configureK8sAuth(clientLB, clientsetK8s); err != nil {
-				log.Error(err.Error())
-				os.Exit(1)
-			}
+		if err := configureVault(ctx, clientLB, clientsetK8s, spec); err != nil {
+			return err
 		}
+		runReport.manage(spec)
 
-		// add policy
-		if err := addPolicy(clientLB); err != nil {
-			log.Error(err.Error())
-			os.Exit(1)
+		if vaultSARoles {
+			if err := syncServiceAccountRoles(ctx, clientLB, clientsetK8s, roleNames(spec.Roles)); err != nil {
+				return fmt.Errorf("service account roles: %w", err)
+			}
 		}
 
-		// add roles
-		// roleFromVars := vaultSaRole{
-		// 	vaultK8sAuthServiceAccount,
-		// 	vaultK8sAuthServiceAccount,
-		// 	namespace,
-		// }
-		// saRoles = append(saRoles, roleFromVars)
-		// log.Infof("%s", saRoles)
-		for _, role := range saRoles {
-			if err := addRole(clientLB, &role); err != nil {
-				log.Error(err.Error())
-				os.Exit(1)
+		if vaultTenantNamespaceSelector != "" {
+			if err := syncTenants(ctx, clientLB, clientsetK8s); err != nil {
+				return fmt.Errorf("tenants: %w", err)
 			}
 		}
 
-		// enable secret engine
-		secret, err := checkSecretEngine(clientLB)
-		if err != nil {
-			log.Errorf(err.Error())
-			os.Exit(1)
-		}
-		if !secret {
-			if err := enableSecretEngine(clientLB); err != nil {
-				log.Error(err.Error())
-				os.Exit(1)
+		if vaultSmokeTest {
+			if err := smokeTest(ctx, clientLB, clientsetK8s, spec.Roles); err != nil {
+				return fmt.Errorf("smoke test: %w", err)
 			}
 		}
-
-		return
 	}
+
+	runReport.nodes = collectNodeStatus(ctx, vaultPods)
+	logNodeStatus(runReport.nodes)
+	return nil
 }
@@ -0,0 +1,380 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	controllerResync        = 5 * time.Minute
+	controllerLeaseDuration = 15 * time.Second
+	controllerRenewDeadline = 10 * time.Second
+	controllerRetryPeriod   = 2 * time.Second
+)
+
+// Kinds of objects in the controller work queue
+const (
+	queueKindPod            = "Pod"
+	queueKindVaultBootstrap = "VaultBootstrap"
+	queueKindServiceAccount = "ServiceAccount"
+	// queueKindServiceAccountSync is a full pass over all ServiceAccounts,
+	// pruning the roles of those deleted while no controller was running
+	queueKindServiceAccountSync = "ServiceAccountSync"
+)
+
+type queueKey struct {
+	kind string
+	name string
+}
+
+// controller watches the Vault pods and brings every member that restarts
+// or becomes unready back into the cluster. Optionally it also applies
+// VaultBootstrap resources and the roles declared by ServiceAccounts.
+type controller struct {
+	clientsetK8s kubernetes.Interface
+	members      map[string]vaultPod
+	leader       vaultPod
+	queue        workqueue.RateLimitingInterface
+
+	bootstraps         cache.Store
+	bootstrapReconcile *vaultBootstrapReconciler
+
+	serviceAccounts cache.Store
+	// specRoles are the role names of the spec, never claimed by a
+	// ServiceAccount
+	specRoles map[string]bool
+
+	unsealKeys *unsealKeyCache
+}
+
+// Controller runs the controller until ctx is cancelled. Only the replica
+// holding the lease reconciles.
+func Controller(ctx context.Context) {
+	clientsetK8s, err := newK8sClientset()
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	startEvents(ctx, clientsetK8s)
+	if err := loadVaultTLSFromSecret(ctx, clientsetK8s); err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	vaultPods, err := newVaultPods(strings.Split(vaultClusterMembers, ","))
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	c := &controller{
+		clientsetK8s: clientsetK8s,
+		members:      make(map[string]vaultPod, len(vaultPods)),
+		leader:       vaultPods[0],
+		queue:        workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		unsealKeys:   &unsealKeyCache{clientsetK8s: clientsetK8s},
+	}
+	for _, pod := range vaultPods {
+		c.members[pod.name] = pod
+	}
+	if vaultSARoles {
+		spec, err := loadSpec()
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		c.specRoles = roleNames(spec.Roles)
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      vaultControllerLeaseName,
+				Namespace: namespace,
+			},
+			Client:     clientsetK8s.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   controllerLeaseDuration,
+		RenewDeadline:   controllerRenewDeadline,
+		RetryPeriod:     controllerRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: c.run,
+			OnStoppedLeading: func() {
+				log.Infof("controller: %s stopped leading", identity)
+			},
+			OnNewLeader: func(current string) {
+				if current != identity {
+					log.Infof("controller: %s is the leader", current)
+				}
+			},
+		},
+	})
+}
+
+func (c *controller) run(ctx context.Context) {
+	defer c.queue.ShutDown()
+	log.Info("controller: started leading")
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clientsetK8s, controllerResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = vaultPodLabelSelector
+		}),
+	)
+	podInformer := factory.Core().V1().Pods().Informer()
+	synced := []cache.InformerSynced{podInformer.HasSynced}
+	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, newPod := oldObj.(*corev1.Pod), newObj.(*corev1.Pod)
+			// Periodic resyncs re-check every member
+			if oldPod.ResourceVersion == newPod.ResourceVersion || podChanged(oldPod, newPod) {
+				c.enqueue(newObj)
+			}
+		},
+	})
+	factory.Start(ctx.Done())
+
+	if vaultControllerCRD {
+		dynamicClient, err := newDynamicClient()
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+		c.bootstrapReconcile = &vaultBootstrapReconciler{clientsetK8s: c.clientsetK8s, dynamicClient: dynamicClient}
+		dynamicFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, controllerResync, namespace, nil)
+		bootstrapInformer := dynamicFactory.ForResource(vaultBootstrapGVR).Informer()
+		bootstrapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: c.enqueueBootstrap,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldBootstrap, newBootstrap := oldObj.(*unstructured.Unstructured), newObj.(*unstructured.Unstructured)
+				// Status updates don't change the generation
+				if oldBootstrap.GetResourceVersion() == newBootstrap.GetResourceVersion() || oldBootstrap.GetGeneration() != newBootstrap.GetGeneration() {
+					c.enqueueBootstrap(newObj)
+				}
+			},
+		})
+		c.bootstraps = bootstrapInformer.GetStore()
+		synced = append(synced, bootstrapInformer.HasSynced)
+		dynamicFactory.Start(ctx.Done())
+	}
+
+	if vaultSARoles {
+		// ServiceAccounts are watched in all namespaces
+		saFactory := informers.NewSharedInformerFactory(c.clientsetK8s, controllerResync)
+		saInformer := saFactory.Core().V1().ServiceAccounts().Informer()
+		saInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: c.enqueueServiceAccount,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.enqueueServiceAccount(newObj)
+			},
+			DeleteFunc: c.enqueueServiceAccount,
+		})
+		c.serviceAccounts = saInformer.GetStore()
+		synced = append(synced, saInformer.HasSynced)
+		saFactory.Start(ctx.Done())
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		log.Error("controller: cannot sync informers")
+		return
+	}
+	if vaultSARoles {
+		c.queue.Add(queueKey{kind: queueKindServiceAccountSync})
+	}
+
+	workers := vaultUnsealConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.worker, time.Second)
+	}
+	<-ctx.Done()
+	log.Info("controller: shutting down")
+}
+
+// podChanged reports whether a container restarted, the readiness of the
+// pod changed or the pod was replaced
+func podChanged(oldPod, newPod *corev1.Pod) bool {
+	if oldPod.UID != newPod.UID || podReady(oldPod) != podReady(newPod) {
+		return true
+	}
+	return restartCount(oldPod) != restartCount(newPod)
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func restartCount(pod *corev1.Pod) int32 {
+	var count int32
+	for _, s := range pod.Status.ContainerStatuses {
+		count += s.RestartCount
+	}
+	return count
+}
+
+func (c *controller) enqueue(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	if _, ok := c.members[pod.Name]; !ok {
+		log.Debugf("controller: %s is not a cluster member, ignoring", pod.Name)
+		return
+	}
+	c.queue.Add(queueKey{kind: queueKindPod, name: pod.Name})
+}
+
+func (c *controller) enqueueBootstrap(obj interface{}) {
+	if bootstrap, ok := obj.(*unstructured.Unstructured); ok {
+		c.queue.Add(queueKey{kind: queueKindVaultBootstrap, name: bootstrap.GetName()})
+	}
+}
+
+func (c *controller) enqueueServiceAccount(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	c.queue.Add(queueKey{kind: queueKindServiceAccount, name: key})
+}
+
+func (c *controller) worker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	var err error
+	switch k := key.(queueKey); k.kind {
+	case queueKindPod:
+		err = c.reconcile(ctx, k.name)
+	case queueKindVaultBootstrap:
+		err = c.reconcileBootstrap(ctx, k.name)
+	case queueKindServiceAccount:
+		err = c.reconcileServiceAccount(ctx, k.name)
+	case queueKindServiceAccountSync:
+		err = c.syncServiceAccounts(ctx)
+	}
+	if err != nil {
+		log.Warnf("controller: %s, retrying", err.Error())
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// reconcile runs the preflight, join and unseal steps for a single member
+func (c *controller) reconcile(ctx context.Context, name string) error {
+	pod, ok := c.members[name]
+	if !ok {
+		return fmt.Errorf("%s is not a cluster member", name)
+	}
+	log.Debugf("controller: reconciling %s", name)
+	status, err := ensureMemberUnsealed(ctx, pod, c.leader, c.unsealKeys.load)
+	if err != nil {
+		c.unsealKeys.reset()
+		return err
+	}
+	if !status.initialized || status.sealed {
+		log.Infof("controller: %s is unsealed", name)
+	}
+	return nil
+}
+
+// reconcileBootstrap applies a VaultBootstrap resource, unless it was
+// deleted in the meantime
+func (c *controller) reconcileBootstrap(ctx context.Context, name string) error {
+	obj, exists, err := c.bootstraps.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	log.Debugf("controller: reconciling VaultBootstrap %s", name)
+	return c.bootstrapReconcile.reconcile(ctx, obj.(*unstructured.Unstructured))
+}
+
+// reconcileServiceAccount writes or deletes the role declared by a
+// ServiceAccount, key is namespace/name
+func (c *controller) reconcileServiceAccount(ctx context.Context, key string) error {
+	obj, exists, err := c.serviceAccounts.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	var sa *corev1.ServiceAccount
+	if exists {
+		sa = obj.(*corev1.ServiceAccount)
+	}
+	if !serviceAccountRoleRelevant(key, sa) {
+		return nil
+	}
+	log.Debugf("controller: reconciling ServiceAccount %s", key)
+	client, err := c.rootClient(ctx)
+	if err != nil {
+		return err
+	}
+	return reconcileServiceAccountRole(ctx, client, c.clientsetK8s, key, sa, c.specRoles)
+}
+
+// syncServiceAccounts writes the roles of all ServiceAccounts and prunes the
+// roles whose ServiceAccount is gone
+func (c *controller) syncServiceAccounts(ctx context.Context) error {
+	log.Debug("controller: syncing all ServiceAccount roles")
+	client, err := c.rootClient(ctx)
+	if err != nil {
+		return err
+	}
+	return syncServiceAccountRoles(ctx, client, c.clientsetK8s, c.specRoles)
+}
+
+// rootClient returns a client of the leader carrying the root token
+func (c *controller) rootClient(ctx context.Context) (*vault.Client, error) {
+	rootToken, err := loadRootToken(ctx, c.clientsetK8s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load root token: %w", err)
+	}
+	client, err := c.leader.client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(rootToken)
+	return client, nil
+}
@@ -4,43 +4,123 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	DefaultLogLevel            = "Info"
-	DefaultVaultAddr           = "https://vault:8200"
-	DefaultVaultClusterMembers = "https://vault:8200"
-	DefaultVaultKeyShares      = 1
-	DefaultVaultKeyThreshold   = 1
-	DefaultVaultInit           = true
-	DefaultVaultK8sSecret      = true
-	DefaultVaultUnseal         = true
-	DefaultVaultK8sAuth        = true
-	DefaultVaultServiceAccount = "vault"
-	DefaultVaultSecretRoot     = "vault-root-token"
-	DefaultVaultSecretUnseal   = "vault-unseal-keys"
+	DefaultLogLevel               = "Info"
+	DefaultVaultAddr              = "https://vault:8200"
+	DefaultVaultClusterMembers    = "https://vault:8200"
+	DefaultVaultKeyShares         = 1
+	DefaultVaultKeyThreshold      = 1
+	DefaultVaultUnsealConcurrency = 3
+	DefaultVaultInit              = true
+	DefaultVaultK8sSecret         = true
+	DefaultVaultUnseal            = true
+	DefaultVaultK8sAuth           = true
+	DefaultVaultServiceAccount    = "vault"
+	DefaultVaultSecretRoot        = "vault-root-token"
+	DefaultVaultSecretUnseal      = "vault-unseal-keys"
+	DefaultRetryInitialInterval   = 1 * time.Second
+	DefaultRetryMaxInterval       = 30 * time.Second
+	DefaultRetryMultiplier        = 2.0
+	DefaultRetryJitter            = 0.2
+	DefaultStepTimeout            = 5 * time.Minute
+	DefaultBootstrapTimeout       = 30 * time.Minute
+	DefaultInitContainerWait      = false
+	DefaultInitContainerTimeout   = 10 * time.Minute
+	DefaultInitContainerContinue  = false
+	DefaultJobTTLSeconds          = 3600
+	DefaultVaultK8sContainerName  = "vault-bootstrap"
+	DefaultVaultSidecarAddr       = "https://127.0.0.1:8200"
+	DefaultVaultSidecarInterval   = 10 * time.Second
+	DefaultVaultSidecarListenAddr = ":8099"
+	DefaultVaultPodLabelSelector  = "app.kubernetes.io/name=vault"
+	DefaultVaultControllerLease   = "vault-bootstrap-controller"
+	DefaultVaultControllerCRD     = false
+	DefaultVaultReportConfigMap   = "vault-bootstrap-report"
+	DefaultVaultK8sAuthPath       = "kubernetes"
+	DefaultVaultK8sAuthReviewer   = false
+	DefaultVaultK8sAuthReviewerSA = "vault-token-reviewer"
+	DefaultVaultSARoles           = false
+	DefaultVaultLedgerConfigMap   = "vault-bootstrap-ledger"
+	DefaultVaultTenantMount       = "secret"
+	DefaultVaultAppRolePath       = "approle"
 )
 
 var (
-	logLevel            string
-	namespace           string
-	vaultAddr           string
-	vaultClusterMembers string
-	vaultKeyShares      int
-	vaultKeyThreshold   int
-	vaultInit           bool
-	vaultK8sSecret      bool
-	vaultUnseal         bool
-	vaultK8sAuth        bool
-	err                 error
-	ok                  bool
+	logLevel               string
+	namespace              string
+	vaultAddr              string
+	vaultClusterMembers    string
+	vaultKeyShares         int
+	vaultKeyThreshold      int
+	vaultUnsealConcurrency int
+	vaultInit              bool
+	vaultK8sSecret         bool
+	vaultUnseal            bool
+	vaultK8sAuth           bool
+	err                    error
+	ok                     bool
 
 	vaultServiceAccount        string
 	vaultK8sAuthServiceAccount string
 	vaultSecretRoot            string
 	vaultSecretUnseal          string
+
+	vaultTLS       vault.TLSConfig
+	vaultTLSSecret string
+
+	vaultRetryPolicy      retryPolicy
+	vaultBootstrapTimeout time.Duration
+
+	initContainerWait              bool
+	initContainerTimeout           time.Duration
+	initContainerContinueOnFailure bool
+	jobTTLSecondsAfterFinished     int32
+	vaultK8sContainerName          string
+	vaultJobTemplateConfigMap      string
+
+	vaultSidecarAddr       string
+	vaultSidecarInterval   time.Duration
+	vaultSidecarListenAddr string
+
+	vaultPodLabelSelector    string
+	vaultControllerLeaseName string
+	vaultControllerCRD       bool
+
+	vaultBootstrapSpecFile string
+	vaultReportConfigMap   string
+
+	vaultK8sAuthPath                 string
+	vaultK8sAuthKubernetesHost       string
+	vaultK8sAuthCACert               string
+	vaultK8sAuthTokenReviewerJWT     string
+	vaultK8sAuthPEMKeys              []string
+	vaultK8sAuthIssuer               string
+	vaultK8sAuthDisableIssValidation *bool
+	vaultK8sAuthDisableLocalCAJWT    *bool
+
+	vaultK8sAuthReviewer               bool
+	vaultK8sAuthReviewerServiceAccount string
+	vaultK8sAuthReviewerTokenTTL       time.Duration
+	vaultK8sAuthReviewerRotate         bool
+
+	vaultSARoles                bool
+	vaultSARolesAllowedPolicies []string
+	vaultLedgerConfigMap        string
+
+	vaultTenantNamespaceSelector string
+	vaultTenantMount             string
+
+	vaultClusterName    string
+	vaultValidateStrict bool
+	vaultSmokeTest      bool
+
+	vaultAppRolePath string
 )
 
 func init() {
@@ -90,6 +170,16 @@ func init() {
 		}
 	}
 
+	if extrVaultUnsealConcurrency, ok := os.LookupEnv("VAULT_UNSEAL_CONCURRENCY"); !ok {
+		log.Warn("VAULT_UNSEAL_CONCURRENCY not set. Defaulting to ", DefaultVaultUnsealConcurrency)
+		vaultUnsealConcurrency = DefaultVaultUnsealConcurrency
+	} else {
+		vaultUnsealConcurrency, err = strconv.Atoi(extrVaultUnsealConcurrency)
+		if err != nil {
+			log.Error("Invalid value for VAULT_UNSEAL_CONCURRENCY" + err.Error())
+		}
+	}
+
 	if extrVaultInit, ok := os.LookupEnv("VAULT_ENABLE_INIT"); !ok {
 		log.Warn("VAULT_ENABLE_INIT not set. Defaulting to ", DefaultVaultInit)
 		vaultInit = DefaultVaultInit
@@ -157,4 +247,265 @@ func init() {
 	} else {
 		vaultSecretUnseal = extrVaultSecretUnseal
 	}
+
+	if extrRetryInitialInterval, ok := os.LookupEnv("VAULT_RETRY_INITIAL_INTERVAL"); !ok {
+		vaultRetryPolicy.initialInterval = DefaultRetryInitialInterval
+	} else {
+		vaultRetryPolicy.initialInterval, err = time.ParseDuration(extrRetryInitialInterval)
+		if err != nil {
+			log.Error("Invalid value for VAULT_RETRY_INITIAL_INTERVAL" + err.Error())
+		}
+	}
+
+	if extrRetryMaxInterval, ok := os.LookupEnv("VAULT_RETRY_MAX_INTERVAL"); !ok {
+		vaultRetryPolicy.maxInterval = DefaultRetryMaxInterval
+	} else {
+		vaultRetryPolicy.maxInterval, err = time.ParseDuration(extrRetryMaxInterval)
+		if err != nil {
+			log.Error("Invalid value for VAULT_RETRY_MAX_INTERVAL" + err.Error())
+		}
+	}
+
+	if extrRetryMultiplier, ok := os.LookupEnv("VAULT_RETRY_MULTIPLIER"); !ok {
+		vaultRetryPolicy.multiplier = DefaultRetryMultiplier
+	} else {
+		vaultRetryPolicy.multiplier, err = strconv.ParseFloat(extrRetryMultiplier, 64)
+		if err != nil {
+			log.Error("Invalid value for VAULT_RETRY_MULTIPLIER" + err.Error())
+		}
+	}
+
+	if extrRetryJitter, ok := os.LookupEnv("VAULT_RETRY_JITTER"); !ok {
+		vaultRetryPolicy.jitter = DefaultRetryJitter
+	} else {
+		vaultRetryPolicy.jitter, err = strconv.ParseFloat(extrRetryJitter, 64)
+		if err != nil {
+			log.Error("Invalid value for VAULT_RETRY_JITTER" + err.Error())
+		}
+	}
+
+	if extrStepTimeout, ok := os.LookupEnv("VAULT_STEP_TIMEOUT"); !ok {
+		vaultRetryPolicy.stepTimeout = DefaultStepTimeout
+	} else {
+		vaultRetryPolicy.stepTimeout, err = time.ParseDuration(extrStepTimeout)
+		if err != nil {
+			log.Error("Invalid value for VAULT_STEP_TIMEOUT" + err.Error())
+		}
+	}
+
+	if extrBootstrapTimeout, ok := os.LookupEnv("VAULT_BOOTSTRAP_TIMEOUT"); !ok {
+		vaultBootstrapTimeout = DefaultBootstrapTimeout
+	} else {
+		vaultBootstrapTimeout, err = time.ParseDuration(extrBootstrapTimeout)
+		if err != nil {
+			log.Error("Invalid value for VAULT_BOOTSTRAP_TIMEOUT" + err.Error())
+		}
+	}
+
+	// TLS settings for every Vault connection, named like the Vault CLI ones
+	vaultTLS.CACert = os.Getenv("VAULT_CACERT")
+	vaultTLS.CAPath = os.Getenv("VAULT_CAPATH")
+	vaultTLS.ClientCert = os.Getenv("VAULT_CLIENT_CERT")
+	vaultTLS.ClientKey = os.Getenv("VAULT_CLIENT_KEY")
+	vaultTLS.TLSServerName = os.Getenv("VAULT_TLS_SERVER_NAME")
+	vaultTLSSecret = os.Getenv("VAULT_TLS_SECRET")
+
+	if extrVaultSkipVerify, ok := os.LookupEnv("VAULT_SKIP_VERIFY"); ok {
+		vaultTLS.Insecure, err = strconv.ParseBool(extrVaultSkipVerify)
+		if err != nil {
+			log.Error("Invalid value for VAULT_SKIP_VERIFY" + err.Error())
+		}
+	}
+	if vaultTLS.Insecure {
+		log.Warn("VAULT_SKIP_VERIFY set. TLS certificates of Vault will not be verified")
+	}
+
+	if extrInitContainerWait, ok := os.LookupEnv("VAULT_INIT_CONTAINER_WAIT"); !ok {
+		initContainerWait = DefaultInitContainerWait
+	} else {
+		initContainerWait, err = strconv.ParseBool(extrInitContainerWait)
+		if err != nil {
+			log.Error("Invalid value for VAULT_INIT_CONTAINER_WAIT" + err.Error())
+		}
+	}
+
+	if extrInitContainerTimeout, ok := os.LookupEnv("VAULT_INIT_CONTAINER_TIMEOUT"); !ok {
+		initContainerTimeout = DefaultInitContainerTimeout
+	} else {
+		initContainerTimeout, err = time.ParseDuration(extrInitContainerTimeout)
+		if err != nil {
+			log.Error("Invalid value for VAULT_INIT_CONTAINER_TIMEOUT" + err.Error())
+		}
+	}
+
+	if extrInitContainerContinue, ok := os.LookupEnv("VAULT_INIT_CONTAINER_CONTINUE_ON_FAILURE"); !ok {
+		initContainerContinueOnFailure = DefaultInitContainerContinue
+	} else {
+		initContainerContinueOnFailure, err = strconv.ParseBool(extrInitContainerContinue)
+		if err != nil {
+			log.Error("Invalid value for VAULT_INIT_CONTAINER_CONTINUE_ON_FAILURE" + err.Error())
+		}
+	}
+
+	if extrJobTTL, ok := os.LookupEnv("VAULT_JOB_TTL_SECONDS_AFTER_FINISHED"); !ok {
+		jobTTLSecondsAfterFinished = DefaultJobTTLSeconds
+	} else {
+		ttl, err := strconv.ParseInt(extrJobTTL, 10, 32)
+		if err != nil {
+			log.Error("Invalid value for VAULT_JOB_TTL_SECONDS_AFTER_FINISHED" + err.Error())
+		}
+		jobTTLSecondsAfterFinished = int32(ttl)
+	}
+
+	if vaultK8sContainerName, ok = os.LookupEnv("VAULT_K8S_CONTAINER_NAME"); !ok {
+		vaultK8sContainerName = DefaultVaultK8sContainerName
+	}
+
+	vaultJobTemplateConfigMap = os.Getenv("VAULT_JOB_TEMPLATE_CONFIGMAP")
+
+	if vaultSidecarAddr, ok = os.LookupEnv("VAULT_SIDECAR_ADDR"); !ok {
+		vaultSidecarAddr = DefaultVaultSidecarAddr
+	}
+
+	if extrVaultSidecarInterval, ok := os.LookupEnv("VAULT_SIDECAR_INTERVAL"); !ok {
+		vaultSidecarInterval = DefaultVaultSidecarInterval
+	} else {
+		vaultSidecarInterval, err = time.ParseDuration(extrVaultSidecarInterval)
+		if err != nil {
+			log.Error("Invalid value for VAULT_SIDECAR_INTERVAL" + err.Error())
+		}
+	}
+
+	if vaultSidecarListenAddr, ok = os.LookupEnv("VAULT_SIDECAR_LISTEN_ADDR"); !ok {
+		vaultSidecarListenAddr = DefaultVaultSidecarListenAddr
+	}
+
+	if vaultPodLabelSelector, ok = os.LookupEnv("VAULT_POD_LABEL_SELECTOR"); !ok {
+		vaultPodLabelSelector = DefaultVaultPodLabelSelector
+	}
+
+	if vaultControllerLeaseName, ok = os.LookupEnv("VAULT_CONTROLLER_LEASE_NAME"); !ok {
+		vaultControllerLeaseName = DefaultVaultControllerLease
+	}
+
+	vaultBootstrapSpecFile = os.Getenv("VAULT_BOOTSTRAP_SPEC_FILE")
+
+	if extrVaultControllerCRD, ok := os.LookupEnv("VAULT_CONTROLLER_CRD"); !ok {
+		vaultControllerCRD = DefaultVaultControllerCRD
+	} else {
+		vaultControllerCRD, err = strconv.ParseBool(extrVaultControllerCRD)
+		if err != nil {
+			log.Error("Invalid value for VAULT_CONTROLLER_CRD" + err.Error())
+		}
+	}
+
+	if vaultReportConfigMap, ok = os.LookupEnv("VAULT_REPORT_CONFIGMAP"); !ok {
+		vaultReportConfigMap = DefaultVaultReportConfigMap
+	}
+
+	if vaultK8sAuthPath, ok = os.LookupEnv("VAULT_K8SAUTH_PATH"); !ok {
+		vaultK8sAuthPath = DefaultVaultK8sAuthPath
+	}
+	vaultK8sAuthPath = strings.Trim(vaultK8sAuthPath, "/")
+
+	vaultK8sAuthKubernetesHost = os.Getenv("VAULT_K8SAUTH_KUBERNETES_HOST")
+	vaultK8sAuthCACert = os.Getenv("VAULT_K8SAUTH_KUBERNETES_CA_CERT")
+	vaultK8sAuthTokenReviewerJWT = os.Getenv("VAULT_K8SAUTH_TOKEN_REVIEWER_JWT")
+	vaultK8sAuthIssuer = os.Getenv("VAULT_K8SAUTH_ISSUER")
+
+	if extrVaultK8sAuthPEMKeys, ok := os.LookupEnv("VAULT_K8SAUTH_PEM_KEYS"); ok {
+		vaultK8sAuthPEMKeys = splitPEMBlocks(extrVaultK8sAuthPEMKeys)
+	}
+
+	if extrVaultK8sAuthDisableIssValidation, ok := os.LookupEnv("VAULT_K8SAUTH_DISABLE_ISS_VALIDATION"); ok {
+		disable, err := strconv.ParseBool(extrVaultK8sAuthDisableIssValidation)
+		if err != nil {
+			log.Error("Invalid value for VAULT_K8SAUTH_DISABLE_ISS_VALIDATION" + err.Error())
+		} else {
+			vaultK8sAuthDisableIssValidation = &disable
+		}
+	}
+
+	if extrVaultK8sAuthDisableLocalCAJWT, ok := os.LookupEnv("VAULT_K8SAUTH_DISABLE_LOCAL_CA_JWT"); ok {
+		disable, err := strconv.ParseBool(extrVaultK8sAuthDisableLocalCAJWT)
+		if err != nil {
+			log.Error("Invalid value for VAULT_K8SAUTH_DISABLE_LOCAL_CA_JWT" + err.Error())
+		} else {
+			vaultK8sAuthDisableLocalCAJWT = &disable
+		}
+	}
+
+	if extrVaultK8sAuthReviewer, ok := os.LookupEnv("VAULT_K8SAUTH_REVIEWER"); !ok {
+		vaultK8sAuthReviewer = DefaultVaultK8sAuthReviewer
+	} else {
+		vaultK8sAuthReviewer, err = strconv.ParseBool(extrVaultK8sAuthReviewer)
+		if err != nil {
+			log.Error("Invalid value for VAULT_K8SAUTH_REVIEWER" + err.Error())
+		}
+	}
+
+	if vaultK8sAuthReviewerServiceAccount, ok = os.LookupEnv("VAULT_K8SAUTH_REVIEWER_SERVICE_ACCOUNT"); !ok {
+		vaultK8sAuthReviewerServiceAccount = DefaultVaultK8sAuthReviewerSA
+	}
+
+	if extrVaultK8sAuthReviewerTokenTTL, ok := os.LookupEnv("VAULT_K8SAUTH_REVIEWER_TOKEN_TTL"); ok {
+		vaultK8sAuthReviewerTokenTTL, err = time.ParseDuration(extrVaultK8sAuthReviewerTokenTTL)
+		if err != nil {
+			log.Error("Invalid value for VAULT_K8SAUTH_REVIEWER_TOKEN_TTL" + err.Error())
+		}
+	}
+
+	if extrVaultK8sAuthReviewerRotate, ok := os.LookupEnv("VAULT_K8SAUTH_REVIEWER_ROTATE"); ok {
+		vaultK8sAuthReviewerRotate, err = strconv.ParseBool(extrVaultK8sAuthReviewerRotate)
+		if err != nil {
+			log.Error("Invalid value for VAULT_K8SAUTH_REVIEWER_ROTATE" + err.Error())
+		}
+	}
+
+	if extrVaultSARoles, ok := os.LookupEnv("VAULT_SA_ROLES"); !ok {
+		vaultSARoles = DefaultVaultSARoles
+	} else {
+		vaultSARoles, err = strconv.ParseBool(extrVaultSARoles)
+		if err != nil {
+			log.Error("Invalid value for VAULT_SA_ROLES" + err.Error())
+		}
+	}
+
+	for _, policy := range strings.Split(os.Getenv("VAULT_SA_ROLES_ALLOWED_POLICIES"), ",") {
+		if policy = strings.TrimSpace(policy); policy != "" {
+			vaultSARolesAllowedPolicies = append(vaultSARolesAllowedPolicies, policy)
+		}
+	}
+
+	if vaultLedgerConfigMap, ok = os.LookupEnv("VAULT_LEDGER_CONFIGMAP"); !ok {
+		vaultLedgerConfigMap = DefaultVaultLedgerConfigMap
+	}
+
+	vaultTenantNamespaceSelector = os.Getenv("VAULT_TENANT_NAMESPACE_SELECTOR")
+
+	if vaultTenantMount, ok = os.LookupEnv("VAULT_TENANT_MOUNT"); !ok {
+		vaultTenantMount = DefaultVaultTenantMount
+	}
+	vaultTenantMount = strings.Trim(vaultTenantMount, "/")
+
+	vaultClusterName = os.Getenv("VAULT_CLUSTER_NAME")
+
+	if extrVaultValidateStrict, ok := os.LookupEnv("VAULT_VALIDATE_STRICT"); ok {
+		vaultValidateStrict, err = strconv.ParseBool(extrVaultValidateStrict)
+		if err != nil {
+			log.Error("Invalid value for VAULT_VALIDATE_STRICT" + err.Error())
+		}
+	}
+
+	if extrVaultSmokeTest, ok := os.LookupEnv("VAULT_SMOKE_TEST"); ok {
+		vaultSmokeTest, err = strconv.ParseBool(extrVaultSmokeTest)
+		if err != nil {
+			log.Error("Invalid value for VAULT_SMOKE_TEST" + err.Error())
+		}
+	}
+
+	if vaultAppRolePath, ok = os.LookupEnv("VAULT_APPROLE_PATH"); !ok {
+		vaultAppRolePath = DefaultVaultAppRolePath
+	}
+	vaultAppRolePath = strings.Trim(vaultAppRolePath, "/")
 }
@@ -0,0 +1,168 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+const (
+	eventComponent = "vault-bootstrap"
+	eventTimeout   = 5 * time.Second
+)
+
+// Reasons of the emitted Events
+const (
+	reasonInitialized     = "Initialized"
+	reasonSecretCreated   = "SecretCreated"
+	reasonRaftJoined      = "RaftJoined"
+	reasonRaftJoinFailed  = "RaftJoinFailed"
+	reasonUnsealed        = "Unsealed"
+	reasonUnsealFailed    = "UnsealFailed"
+	reasonAuthEnabled     = "AuthEnabled"
+	reasonPolicyWritten   = "PolicyWritten"
+	reasonRoleWritten     = "RoleWritten"
+	reasonRoleDeleted     = "RoleDeleted"
+	reasonRoleRefused     = "RoleRefused"
+	reasonPolicyDeleted   = "PolicyDeleted"
+	reasonSmokeTestPassed = "SmokeTestPassed"
+	reasonSmokeTestFailed = "SmokeTestFailed"
+	reasonGroupWritten    = "GroupWritten"
+	reasonGroupDeleted    = "GroupDeleted"
+)
+
+// eventRecorder creates Events synchronously instead of batching them like
+// the client-go broadcaster, so none are lost when the process exits right
+// after a failed step. Without a clientset it only discards events.
+type eventRecorder struct {
+	clientsetK8s kubernetes.Interface
+	// self is the Job, or else the pod, this process runs in
+	self runtime.Object
+
+	mu   sync.Mutex
+	pods map[string]runtime.Object
+}
+
+var _ record.EventRecorder = &eventRecorder{}
+
+// events receives the Events of every bootstrap step
+var events = &eventRecorder{}
+
+// startEvents enables Events for the rest of the run
+func startEvents(ctx context.Context, clientsetK8s kubernetes.Interface) {
+	events = &eventRecorder{
+		clientsetK8s: clientsetK8s,
+		pods:         make(map[string]runtime.Object),
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return
+	}
+	pod, err := clientsetK8s.CoreV1().Pods(namespace).Get(ctx, hostname, metav1.GetOptions{})
+	if err != nil {
+		log.Debugf("events: cannot find own pod %s: %s", hostname, err.Error())
+		return
+	}
+	events.self = pod
+	if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == "Job" {
+		if job, err := clientsetK8s.BatchV1().Jobs(namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err == nil {
+			events.self = job
+		}
+	}
+}
+
+// podEventf emits an Event on the Vault pod, or on the job running the
+// bootstrap if the pod cannot be found
+func (r *eventRecorder) podEventf(podName, eventtype, reason, messageFmt string, args ...interface{}) {
+	runReport.addStep(reason, podName, eventOutcome(eventtype), fmt.Sprintf(messageFmt, args...))
+	if r.clientsetK8s == nil {
+		return
+	}
+	r.mu.Lock()
+	obj, ok := r.pods[podName]
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+		pod, err := r.clientsetK8s.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		cancel()
+		if err == nil {
+			obj = pod
+			r.pods[podName] = obj
+		}
+	}
+	r.mu.Unlock()
+	if obj == nil {
+		if r.self != nil {
+			r.Eventf(r.self, eventtype, reason, "%s: "+messageFmt, append([]interface{}{podName}, args...)...)
+		}
+		return
+	}
+	r.Eventf(obj, eventtype, reason, messageFmt, args...)
+}
+
+// jobEventf emits an Event on the job running the bootstrap
+func (r *eventRecorder) jobEventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	runReport.addStep(reason, "", eventOutcome(eventtype), fmt.Sprintf(messageFmt, args...))
+	if r.self == nil {
+		return
+	}
+	r.Eventf(r.self, eventtype, reason, messageFmt, args...)
+}
+
+// eventOutcome maps the type of an Event to the outcome of its step
+func eventOutcome(eventtype string) string {
+	if eventtype == corev1.EventTypeWarning {
+		return stepFailed
+	}
+	return stepSucceeded
+}
+
+func (r *eventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.AnnotatedEventf(object, nil, eventtype, reason, "%s", message)
+}
+
+func (r *eventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.AnnotatedEventf(object, nil, eventtype, reason, messageFmt, args...)
+}
+
+func (r *eventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.clientsetK8s == nil || object == nil {
+		return
+	}
+	ref, err := reference.GetReference(scheme.Scheme, object)
+	if err != nil {
+		log.Debugf("events: %s", err.Error())
+		return
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace:   ref.Namespace,
+			Annotations: annotations,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        fmt.Sprintf(messageFmt, args...),
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventtype,
+		Source:         corev1.EventSource{Component: eventComponent},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	if _, err := r.clientsetK8s.CoreV1().Events(ref.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		log.Debugf("events: cannot create event %s: %s", reason, err.Error())
+	}
+}
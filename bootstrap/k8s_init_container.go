@@ -2,28 +2,17 @@ package bootstrap
 
 import (
 	"context"
+	"net/url"
 	"os"
-	"strconv"
 	"strings"
 
-	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
-	batchv1 "k8s.io/api/batch/v1"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
-func InitContainer() {
-	// Create clientSet for k8s client-go
-	k8sConfig, err := rest.InClusterConfig()
-	if err != nil {
-		log.Error(err.Error())
-		os.Exit(1)
-	}
-
-	clientsetK8s, err := kubernetes.NewForConfig(k8sConfig)
+// InitContainer spawns a bootstrap job for the pod the init container runs in
+func InitContainer(ctx context.Context) {
+	clientsetK8s, err := newK8sClientset()
 	if err != nil {
 		log.Error(err.Error())
 		os.Exit(1)
@@ -34,87 +23,63 @@ func InitContainer() {
 		panic("Cannot extract Pod name from environment variables")
 	}
 
-	pod, err := clientsetK8s.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	pod, err := clientsetK8s.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		log.Error(err.Error())
 		panic("Cannot extract Pod information from Kubernetes API")
 	}
 
-	randomString := strings.Replace(uuid.New().String(), "-", "", -1)
-	jobName := podName + "-bootstrap-" + randomString[0:4]
-	JobImage := pod.Status.InitContainerStatuses[0].Image
-
-	job := &batchv1.Job{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      jobName,
-			Namespace: namespace,
-		},
-		Spec: batchv1.JobSpec{
-			Template: corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					RestartPolicy:      "Never",
-					ServiceAccountName: vaultServiceAccount,
-					Containers: []corev1.Container{
-						{
-							Name:  jobName,
-							Image: JobImage,
-							Env: []corev1.EnvVar{
-								{
-									Name:  "LOG_LEVEL",
-									Value: logLevel,
-								},
-								{
-									Name:  "VAULT_ADDR",
-									Value: vaultAddr,
-								},
-								{
-									Name:  "VAULT_CLUSTER_MEMBERS",
-									Value: vaultClusterMembers,
-								},
-								{
-									Name:  "VAULT_KEY_SHARES",
-									Value: strconv.Itoa(vaultKeyShares),
-								},
-								{
-									Name:  "VAULT_KEY_THRESHOLD",
-									Value: strconv.Itoa(vaultKeyThreshold),
-								},
-								{
-									Name:  "VAULT_ENABLE_INIT",
-									Value: strconv.FormatBool(vaultInit),
-								},
-								{
-									Name:  "VAULT_ENABLE_K8SSECRET",
-									Value: strconv.FormatBool(vaultK8sSecret),
-								},
-								{
-									Name:  "VAULT_ENABLE_UNSEAL",
-									Value: strconv.FormatBool(vaultUnseal),
-								},
-								{
-									Name:  "VAULT_ENABLE_K8SAUTH",
-									Value: strconv.FormatBool(vaultK8sAuth),
-								},
-								{
-									Name:  "VAULT_SERVICE_ACCOUNT",
-									Value: vaultServiceAccount,
-								},
-								{
-									Name:  "VAULT_K8SAUTH_SERVICE_ACCOUNT",
-									Value: vaultK8sAuthServiceAccount,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
+	container, err := findInitContainer(pod)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
 	}
+	tmpl, err := loadJobTemplate(ctx, clientsetK8s)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Pods of the same StatefulSet share one job, owned by the StatefulSet
+	owner := jobOwner(pod)
+	job := newBootstrapJob(tmpl, pod, container, owner, owner.Name+"-bootstrap")
 
-	result, err := clientsetK8s.BatchV1().Jobs(namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	result, err := ensureJob(ctx, clientsetK8s, job)
 	if err != nil {
 		log.Error(err.Error())
 		panic("Failed to create job")
 	}
-	log.Info("Created job ", result.GetObjectMeta().GetName())
+
+	if !initContainerWait {
+		return
+	}
+	// The job waits for every member, including this pod, whose Vault
+	// cannot start before the init container exits
+	if isClusterMember(pod.Name, strings.Split(vaultClusterMembers, ",")) {
+		log.Warnf("Pod %s is a member of VAULT_CLUSTER_MEMBERS, waiting for the job would deadlock. Not waiting", pod.Name)
+		return
+	}
+	if err := waitForJob(ctx, clientsetK8s, result.GetName()); err != nil {
+		if initContainerContinueOnFailure {
+			log.Warnf("%s. Continuing anyway", err.Error())
+			return
+		}
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// isClusterMember reports whether one of the member URLs points at the pod.
+// Like in newVaultPods, the pod name is the first label of the host name.
+func isClusterMember(podName string, members []string) bool {
+	for _, member := range members {
+		memberURL, err := url.Parse(strings.TrimSpace(member))
+		if err != nil {
+			continue
+		}
+		if strings.Split(memberURL.Hostname(), ".")[0] == podName {
+			return true
+		}
+	}
+	return false
 }
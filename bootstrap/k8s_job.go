@@ -0,0 +1,91 @@
+package bootstrap
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// jobOwner returns the owner of the bootstrap job: the controller of the pod
+// (usually the Vault StatefulSet) or, if there is none, the pod itself
+func jobOwner(pod *corev1.Pod) metav1.OwnerReference {
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		return metav1.OwnerReference{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			UID:        ref.UID,
+		}
+	}
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// ensureJob creates the job unless a job with the same name is still running,
+// in which case that one is reused. A finished job is deleted and replaced.
+func ensureJob(ctx context.Context, clientsetK8s kubernetes.Interface, job *batchv1.Job) (*batchv1.Job, error) {
+	jobs := clientsetK8s.BatchV1().Jobs(namespace)
+	existing, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return nil, err
+	case !jobFinished(existing):
+		log.Info("Reusing running job ", existing.Name)
+		return existing, nil
+	default:
+		log.Info("Deleting finished job ", existing.Name)
+		if err := deleteJob(ctx, clientsetK8s, existing); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := jobs.Create(ctx, job, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// Another pod created it in the meantime
+		existing, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Reusing running job ", existing.Name)
+		return existing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Created job ", result.GetObjectMeta().GetName())
+	return result, nil
+}
+
+// deleteJob deletes the job with its pods and waits until it is gone
+func deleteJob(ctx context.Context, clientsetK8s kubernetes.Interface, job *batchv1.Job) error {
+	jobs := clientsetK8s.BatchV1().Jobs(namespace)
+	propagation := metav1.DeletePropagationBackground
+	err := jobs.Delete(ctx, job.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     &metav1.Preconditions{UID: &job.UID},
+	})
+	if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+		return err
+	}
+	return retry(ctx, "job "+job.Name+": wait for deletion", func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// Replaced by another pod already
+		return current.UID != job.UID, nil
+	})
+}
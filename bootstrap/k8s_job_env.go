@@ -0,0 +1,76 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Env vars that only make sense in the init container itself
+var initContainerOnlyEnv = map[string]bool{
+	"VAULT_K8S_POD_NAME":       true,
+	"VAULT_K8S_CONTAINER_NAME": true,
+}
+
+// findInitContainer returns the init container this process runs in
+func findInitContainer(pod *corev1.Pod) (*corev1.Container, error) {
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == vaultK8sContainerName {
+			return &pod.Spec.InitContainers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("init container %s not found in pod %s", vaultK8sContainerName, pod.Name)
+}
+
+// jobEnv returns the env of the init container, so the job runs with exactly
+// the same settings. References to ConfigMaps, Secrets and fields are kept
+// as they are instead of being resolved.
+func jobEnv(container *corev1.Container) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	hasNamespace := false
+	for _, e := range container.Env {
+		if initContainerOnlyEnv[e.Name] {
+			continue
+		}
+		if e.Name == "NAMESPACE" {
+			hasNamespace = true
+		}
+		env = append(env, e)
+	}
+	if !hasNamespace {
+		// The init container may have resolved it from its service account
+		env = append(env, corev1.EnvVar{Name: "NAMESPACE", Value: namespace})
+	}
+	return env
+}
+
+// jobVolumes returns the volume mounts of the init container together with
+// the pod volumes they refer to, so file based settings such as VAULT_CACERT
+// resolve in the job too. The service account token volume is left out,
+// the job pod gets its own.
+func jobVolumes(pod *corev1.Pod, container *corev1.Container) ([]corev1.Volume, []corev1.VolumeMount) {
+	podVolumes := make(map[string]corev1.Volume, len(pod.Spec.Volumes))
+	for _, v := range pod.Spec.Volumes {
+		podVolumes[v.Name] = v
+	}
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	seen := make(map[string]bool)
+	for _, m := range container.VolumeMounts {
+		v, ok := podVolumes[m.Name]
+		if !ok || strings.HasPrefix(m.Name, "kube-api-access-") {
+			continue
+		}
+		if v.PersistentVolumeClaim != nil {
+			// Usually ReadWriteOnce and already in use by the Vault pod
+			continue
+		}
+		mounts = append(mounts, m)
+		if !seen[v.Name] {
+			seen[v.Name] = true
+			volumes = append(volumes, v)
+		}
+	}
+	return volumes, mounts
+}
@@ -0,0 +1,97 @@
+package bootstrap
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// settingsEnv returns every env var read in init.go
+func settingsEnv(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "init.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "LookupEnv" && sel.Sel.Name != "Getenv") {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "os" {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			key, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if len(keys) == 0 {
+		t.Fatal("no env vars found in init.go")
+	}
+	return keys
+}
+
+func TestJobEnvPropagatesSettings(t *testing.T) {
+	keys := settingsEnv(t)
+	container := &corev1.Container{}
+	for _, key := range keys {
+		container.Env = append(container.Env, corev1.EnvVar{Name: key, Value: "value-of-" + key})
+	}
+
+	got := map[string]string{}
+	for _, e := range jobEnv(container) {
+		got[e.Name] = e.Value
+	}
+	for _, key := range keys {
+		value, ok := got[key]
+		if initContainerOnlyEnv[key] {
+			if ok {
+				t.Errorf("%s is only meant for the init container but was passed to the job", key)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s is not passed to the job; add it to initContainerOnlyEnv if that is intended", key)
+		} else if value != "value-of-"+key {
+			t.Errorf("%s = %q, want %q", key, value, "value-of-"+key)
+		}
+	}
+}
+
+func TestJobEnvAddsNamespace(t *testing.T) {
+	env := jobEnv(&corev1.Container{Env: []corev1.EnvVar{{Name: "VAULT_ADDR", Value: "https://vault:8200"}}})
+	for _, e := range env {
+		if e.Name == "NAMESPACE" {
+			if e.Value != namespace {
+				t.Errorf("NAMESPACE = %q, want %q", e.Value, namespace)
+			}
+			return
+		}
+	}
+	t.Error("NAMESPACE not added")
+}
+
+func TestJobEnvKeepsReferences(t *testing.T) {
+	ref := &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "vault-tls"},
+		Key:                  "ca.crt",
+	}}
+	env := jobEnv(&corev1.Container{Env: []corev1.EnvVar{{Name: "VAULT_CACERT", ValueFrom: ref}}})
+	if len(env) == 0 || env[0].ValueFrom != ref {
+		t.Errorf("reference of VAULT_CACERT not kept: %+v", env)
+	}
+}
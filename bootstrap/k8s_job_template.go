@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Key of the job template in the VAULT_JOB_TEMPLATE_CONFIGMAP ConfigMap
+const jobTemplateKey = "job.yaml"
+
+// loadJobTemplate reads the user-supplied job template. Without a configured
+// ConfigMap an empty job is returned.
+func loadJobTemplate(ctx context.Context, clientsetK8s kubernetes.Interface) (*batchv1.Job, error) {
+	tmpl := &batchv1.Job{}
+	if vaultJobTemplateConfigMap == "" {
+		return tmpl, nil
+	}
+	cm, err := clientsetK8s.CoreV1().ConfigMaps(namespace).Get(ctx, vaultJobTemplateConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("job template: cannot read ConfigMap %s: %w", vaultJobTemplateConfigMap, err)
+	}
+	data, ok := cm.Data[jobTemplateKey]
+	if !ok {
+		return nil, fmt.Errorf("job template: ConfigMap %s has no %s key", vaultJobTemplateConfigMap, jobTemplateKey)
+	}
+	if err := yaml.UnmarshalStrict([]byte(data), tmpl); err != nil {
+		return nil, fmt.Errorf("job template: cannot parse %s: %w", jobTemplateKey, err)
+	}
+	return tmpl, nil
+}
+
+// newBootstrapJob builds the job from the template, filling in the fields
+// the bootstrap depends on. Everything else, e.g. resources, securityContext,
+// nodeSelector, tolerations, labels and annotations, is taken from the
+// template as is.
+func newBootstrapJob(tmpl *batchv1.Job, pod *corev1.Pod, container *corev1.Container, owner metav1.OwnerReference, jobName string) *batchv1.Job {
+	job := tmpl.DeepCopy()
+	job.TypeMeta = metav1.TypeMeta{}
+	job.ObjectMeta.Name = jobName
+	job.ObjectMeta.GenerateName = ""
+	job.ObjectMeta.Namespace = namespace
+	job.ObjectMeta.OwnerReferences = []metav1.OwnerReference{owner}
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		job.Spec.TTLSecondsAfterFinished = &jobTTLSecondsAfterFinished
+	}
+
+	spec := &job.Spec.Template.Spec
+	if spec.RestartPolicy != corev1.RestartPolicyOnFailure {
+		spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+	if spec.ServiceAccountName == "" {
+		spec.ServiceAccountName = vaultServiceAccount
+	}
+	if spec.ImagePullSecrets == nil {
+		// The image comes from the Vault pod, so do its pull secrets
+		spec.ImagePullSecrets = pod.Spec.ImagePullSecrets
+	}
+	volumes, volumeMounts := jobVolumes(pod, container)
+	spec.Volumes = append(spec.Volumes, volumes...)
+
+	// The first container of the template is the bootstrap container
+	if len(spec.Containers) == 0 {
+		spec.Containers = []corev1.Container{{}}
+	}
+	c := &spec.Containers[0]
+	if c.Name == "" {
+		c.Name = jobName
+	}
+	if c.Image == "" {
+		c.Image = container.Image
+	}
+	if c.ImagePullPolicy == "" {
+		c.ImagePullPolicy = container.ImagePullPolicy
+	}
+	c.Env = append(jobEnv(container), c.Env...)
+	c.EnvFrom = append(append([]corev1.EnvFromSource{}, container.EnvFrom...), c.EnvFrom...)
+	c.VolumeMounts = append(c.VolumeMounts, volumeMounts...)
+	return job
+}
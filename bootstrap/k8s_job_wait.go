@@ -0,0 +1,88 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const jobPollInterval = 5 * time.Second
+
+// waitForJob polls the job until it completes or fails and returns an error
+// if it failed or did not finish within initContainerTimeout
+func waitForJob(ctx context.Context, clientsetK8s kubernetes.Interface, jobName string) error {
+	log.Infof("Waiting up to %s for job %s to finish", initContainerTimeout, jobName)
+	var job *batchv1.Job
+	err := wait.PollUntilContextTimeout(ctx, jobPollInterval, initContainerTimeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		job, err = clientsetK8s.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			log.Debugf("job %s: %s", jobName, err.Error())
+			return false, nil
+		}
+		log.Debugf("job %s: active=%d succeeded=%d failed=%d", jobName, job.Status.Active, job.Status.Succeeded, job.Status.Failed)
+		return jobFinished(job), nil
+	})
+	if job != nil {
+		printJobLogs(ctx, clientsetK8s, jobName)
+	}
+	if err != nil {
+		return fmt.Errorf("job %s did not finish: %w", jobName, err)
+	}
+	if jobFailed(job) {
+		return fmt.Errorf("job %s failed", jobName)
+	}
+	log.Infof("Job %s completed successfully", jobName)
+	return nil
+}
+
+func jobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func jobFailed(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// printJobLogs copies the logs of every pod of the job to stdout
+func printJobLogs(ctx context.Context, clientsetK8s kubernetes.Interface, jobName string) {
+	pods, err := clientsetK8s.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "job-name=" + jobName,
+	})
+	if err != nil {
+		log.Warnf("Cannot list pods of job %s: %s", jobName, err.Error())
+		return
+	}
+	for _, pod := range pods.Items {
+		stream, err := clientsetK8s.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(ctx)
+		if err != nil {
+			log.Warnf("Cannot get logs of %s: %s", pod.Name, err.Error())
+			continue
+		}
+		log.Infof("----- logs of %s -----", pod.Name)
+		if _, err := io.Copy(os.Stdout, stream); err != nil {
+			log.Warnf("Cannot read logs of %s: %s", pod.Name, err.Error())
+		}
+		stream.Close()
+		log.Infof("----- end of logs of %s -----", pod.Name)
+	}
+}
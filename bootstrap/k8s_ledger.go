@@ -0,0 +1,107 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientretry "k8s.io/client-go/util/retry"
+)
+
+// ledger records which Vault objects the tool created and from which source,
+// so objects whose source disappeared can be pruned. Every ledger is a key of
+// the VAULT_LEDGER_CONFIGMAP ConfigMap.
+type ledger struct {
+	key string
+	// entries maps a Vault object to the object it was created from
+	entries map[string]string
+	// stored are the entries as last read or written
+	stored map[string]string
+}
+
+func loadLedger(ctx context.Context, clientsetK8s kubernetes.Interface, key string) (*ledger, error) {
+	l := &ledger{key: key, entries: map[string]string{}}
+	cm, err := clientsetK8s.CoreV1().ConfigMaps(namespace).Get(ctx, vaultLedgerConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, ok := cm.Data[key]; ok {
+		if err := json.Unmarshal([]byte(data), &l.entries); err != nil {
+			return nil, err
+		}
+	}
+	l.stored = maps.Clone(l.entries)
+	return l, nil
+}
+
+// owned returns the objects created from source, sorted
+func (l *ledger) owned(source string) []string {
+	var objects []string
+	for object, owner := range l.entries {
+		if owner == source {
+			objects = append(objects, object)
+		}
+	}
+	sort.Strings(objects)
+	return objects
+}
+
+// owners returns the set of sources that own at least one object
+func (l *ledger) owners() map[string]bool {
+	owners := make(map[string]bool, len(l.entries))
+	for _, owner := range l.entries {
+		owners[owner] = true
+	}
+	return owners
+}
+
+// save writes the ledger back if its entries changed, creating the ConfigMap
+// if needed
+func (l *ledger) save(ctx context.Context, clientsetK8s kubernetes.Interface) error {
+	if maps.Equal(l.entries, l.stored) {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	configMaps := clientsetK8s.CoreV1().ConfigMaps(namespace)
+	err = clientretry.RetryOnConflict(clientretry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, vaultLedgerConfigMap, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   vaultLedgerConfigMap,
+					Labels: map[string]string{"app.kubernetes.io/managed-by": eventComponent},
+				},
+				Data: map[string]string{l.key: string(data)},
+			}
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[l.key] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	l.stored = maps.Clone(l.entries)
+	log.Debugf("Ledger %s written to ConfigMap %s", l.key, vaultLedgerConfigMap)
+	return nil
+}
@@ -0,0 +1,178 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Version of the tool, set at build time
+var Version = "dev"
+
+// Key of the report in the VAULT_REPORT_CONFIGMAP ConfigMap
+const reportKey = "report.json"
+
+// reportTimeout bounds collecting the node status and writing the report
+const reportTimeout = 30 * time.Second
+
+// Outcomes of a step
+const (
+	stepSucceeded = "succeeded"
+	stepFailed    = "failed"
+	stepSkipped   = "skipped"
+)
+
+// bootstrapReport is the machine-readable record of a job run
+type bootstrapReport struct {
+	Timestamp time.Time    `json:"timestamp"`
+	Version   string       `json:"version"`
+	Succeeded bool         `json:"succeeded"`
+	Error     string       `json:"error,omitempty"`
+	Nodes     []nodeReport `json:"nodes"`
+	Steps     []stepReport `json:"steps"`
+	Policies  []string     `json:"policies"`
+	Roles     []string     `json:"roles"`
+	Mounts    []string     `json:"mounts"`
+
+	mu        sync.Mutex
+	vaultPods []vaultPod
+	nodes     []nodeStatus
+}
+
+type stepReport struct {
+	Time    time.Time `json:"time"`
+	Step    string    `json:"step"`
+	Target  string    `json:"target,omitempty"`
+	Outcome string    `json:"outcome"`
+	Message string    `json:"message,omitempty"`
+}
+
+// runReport collects the steps of the current job run. It is nil in the
+// long-running modes, where every method is a no-op.
+var runReport *bootstrapReport
+
+func newBootstrapReport() *bootstrapReport {
+	return &bootstrapReport{
+		Version:  Version,
+		Nodes:    []nodeReport{},
+		Steps:    []stepReport{},
+		Policies: []string{},
+		Roles:    []string{},
+		Mounts:   []string{},
+	}
+}
+
+func (r *bootstrapReport) addStep(step, target, outcome, message string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Steps = append(r.Steps, stepReport{
+		Time:    time.Now().UTC(),
+		Step:    step,
+		Target:  target,
+		Outcome: outcome,
+		Message: message,
+	})
+}
+
+// manage records the policies, roles and secret engines of the spec as
+// managed by the tool
+func (r *bootstrapReport) manage(spec bootstrapSpec) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, policy := range spec.Policies {
+		r.Policies = append(r.Policies, policy.Name)
+	}
+	for _, role := range spec.Roles {
+		r.Roles = append(r.Roles, role.Name)
+	}
+	for _, role := range spec.AppRoles {
+		r.Roles = append(r.Roles, vaultAppRolePath+"/"+role.Name)
+	}
+	for _, method := range spec.JWTAuth {
+		for _, role := range method.Roles {
+			r.Roles = append(r.Roles, method.path()+"/"+role.Name)
+		}
+	}
+	for _, cluster := range spec.Clusters {
+		for _, role := range cluster.Roles {
+			r.Roles = append(r.Roles, cluster.authPath()+"/"+role.Name)
+		}
+	}
+	for _, mount := range spec.Mounts {
+		r.Mounts = append(r.Mounts, mount.path())
+	}
+}
+
+// manageTenant records the policy and role of an onboarded tenant
+func (r *bootstrapReport) manageTenant(policy, role string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Policies = append(r.Policies, policy)
+	r.Roles = append(r.Roles, role)
+}
+
+// writeReport stores the report of the run in the VAULT_REPORT_CONFIGMAP
+// ConfigMap, creating or replacing it
+func writeReport(ctx context.Context, clientsetK8s kubernetes.Interface, runErr error) error {
+	if runReport == nil || vaultReportConfigMap == "" {
+		return nil
+	}
+	r := runReport
+	r.Timestamp = time.Now().UTC()
+	r.Succeeded = runErr == nil
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+	if r.nodes == nil {
+		r.nodes = collectNodeStatus(ctx, r.vaultPods)
+	}
+	for _, s := range r.nodes {
+		r.Nodes = append(r.Nodes, s.report())
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	configMaps := clientsetK8s.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(ctx, vaultReportConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   vaultReportConfigMap,
+				Labels: map[string]string{"app.kubernetes.io/managed-by": eventComponent},
+			},
+			Data: map[string]string{reportKey: string(data)},
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[reportKey] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("Report written to ConfigMap ", vaultReportConfigMap)
+	return nil
+}
@@ -0,0 +1,233 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Annotations of a ServiceAccount that gets a kubernetes auth role
+const (
+	annotationRole     = "vault-bootstrap/role"
+	annotationPolicies = "vault-bootstrap/policies"
+	annotationTTL      = "vault-bootstrap/ttl"
+)
+
+const saRolesLedgerKey = "serviceaccount-roles.json"
+
+// saRolesMu serializes the ledger updates of concurrent controller workers
+var saRolesMu sync.Mutex
+
+// saRoleOwners caches the ServiceAccounts owning a role in the ledger, so
+// the controller skips the others without reading anything. nil until the
+// ledger was read. Guarded by saRolesMu.
+var saRoleOwners map[string]bool
+
+// serviceAccountRoleRelevant reports whether the ServiceAccount with key
+// declares a role or may own one. sa is nil if it was deleted.
+func serviceAccountRoleRelevant(key string, sa *corev1.ServiceAccount) bool {
+	if sa != nil {
+		if _, ok := serviceAccountRole(sa); ok {
+			return true
+		}
+	}
+	saRolesMu.Lock()
+	defer saRolesMu.Unlock()
+	return saRoleOwners == nil || saRoleOwners[key]
+}
+
+// serviceAccountRole returns the role declared by the annotations of sa
+func serviceAccountRole(sa *corev1.ServiceAccount) (roleSpec, bool) {
+	name := strings.TrimSpace(sa.Annotations[annotationRole])
+	if name == "" {
+		return roleSpec{}, false
+	}
+	role := roleSpec{
+		Name:                     name,
+		ServiceAccountNames:      []string{sa.Name},
+		ServiceAccountNamespaces: []string{sa.Namespace},
+		TTL:                      sa.Annotations[annotationTTL],
+	}
+	for _, policy := range strings.Split(sa.Annotations[annotationPolicies], ",") {
+		if policy = strings.TrimSpace(policy); policy != "" {
+			role.Policies = append(role.Policies, policy)
+		}
+	}
+	return role, true
+}
+
+// refuseServiceAccountRole returns why the role declared by a ServiceAccount
+// must not be written, empty if it may. taken is true when the name belongs
+// to a role of the spec or of a tenant.
+func refuseServiceAccountRole(role roleSpec, specRoles map[string]bool) (reason string, taken bool) {
+	if roleNameTaken(role.Name, specRoles) {
+		return "is reserved for the roles of the spec and the tenants", true
+	}
+	// addRole would fall back to the default policies, which the
+	// allowlist does not cover
+	if len(role.Policies) == 0 {
+		return "has no " + annotationPolicies + " annotation", false
+	}
+	for _, policy := range role.Policies {
+		if policy == "root" {
+			return "must not grant the root policy", false
+		}
+		allowed := false
+		for _, p := range vaultSARolesAllowedPolicies {
+			if p == policy {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("grants policy %s, which is not in VAULT_SA_ROLES_ALLOWED_POLICIES", policy), false
+		}
+	}
+	return "", false
+}
+
+// roleNameTaken reports whether a role of that name belongs to the spec or
+// to a tenant. Such a role is never deleted for a ServiceAccount.
+func roleNameTaken(name string, specRoles map[string]bool) bool {
+	return specRoles[name] || strings.HasPrefix(name, tenantPrefix)
+}
+
+// roleNames returns the set of names of roles
+func roleNames(roles []roleSpec) map[string]bool {
+	names := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		names[role.Name] = true
+	}
+	return names
+}
+
+// syncServiceAccountRoles lists the ServiceAccounts of all namespaces,
+// writes the roles they declare and deletes the roles whose ServiceAccount
+// or annotation is gone. specRoles are the names of the roles of the spec.
+func syncServiceAccountRoles(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, specRoles map[string]bool) error {
+	saRolesMu.Lock()
+	defer saRolesMu.Unlock()
+
+	sas, err := clientsetK8s.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(ctx, clientsetK8s, saRolesLedgerKey)
+	if err != nil {
+		return err
+	}
+
+	declared := map[string]roleSpec{}
+	for i := range sas.Items {
+		if role, ok := serviceAccountRole(&sas.Items[i]); ok {
+			declared[saKey(&sas.Items[i])] = role
+		}
+	}
+	// Prune first, so a role name given up by one ServiceAccount can be
+	// claimed by another one
+	for role, owner := range l.entries {
+		if d, ok := declared[owner]; !ok || d.Name != role {
+			if !roleNameTaken(role, specRoles) {
+				if err := deleteRole(ctx, client, vaultK8sAuthPath, role); err != nil {
+					return err
+				}
+			}
+			delete(l.entries, role)
+		}
+	}
+	keys := make([]string, 0, len(declared))
+	for key := range declared {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := applyServiceAccountRole(ctx, client, l, key, declared[key], specRoles); err != nil {
+			return err
+		}
+	}
+	if err := l.save(ctx, clientsetK8s); err != nil {
+		return err
+	}
+	saRoleOwners = l.owners()
+	return nil
+}
+
+// reconcileServiceAccountRole writes the role of a single ServiceAccount and
+// deletes the roles it no longer declares. sa is nil if it was deleted.
+func reconcileServiceAccountRole(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, key string, sa *corev1.ServiceAccount, specRoles map[string]bool) error {
+	saRolesMu.Lock()
+	defer saRolesMu.Unlock()
+
+	l, err := loadLedger(ctx, clientsetK8s, saRolesLedgerKey)
+	if err != nil {
+		return err
+	}
+	var current string
+	if sa != nil {
+		if role, ok := serviceAccountRole(sa); ok {
+			applied, err := applyServiceAccountRole(ctx, client, l, key, role, specRoles)
+			if err != nil {
+				return err
+			}
+			if applied {
+				current = role.Name
+			}
+		}
+	}
+	for _, role := range l.owned(key) {
+		if role == current {
+			continue
+		}
+		if !roleNameTaken(role, specRoles) {
+			if err := deleteRole(ctx, client, vaultK8sAuthPath, role); err != nil {
+				return err
+			}
+		}
+		delete(l.entries, role)
+	}
+	if err := l.save(ctx, clientsetK8s); err != nil {
+		return err
+	}
+	saRoleOwners = l.owners()
+	return nil
+}
+
+// applyServiceAccountRole writes the role unless it is refused or another
+// ServiceAccount already claimed its name. A refused role that was written
+// before is deleted, unless its name now belongs to the spec or a tenant.
+func applyServiceAccountRole(ctx context.Context, client *vault.Client, l *ledger, key string, role roleSpec, specRoles map[string]bool) (bool, error) {
+	if reason, taken := refuseServiceAccountRole(role, specRoles); reason != "" {
+		log.Warnf("k8s auth role '%s' of %s %s, refusing", role.Name, key, reason)
+		events.jobEventf(corev1.EventTypeWarning, reasonRoleRefused, "Refused k8s auth role %s of ServiceAccount %s: %s", role.Name, key, reason)
+		if l.entries[role.Name] == key {
+			if !taken {
+				if err := deleteRole(ctx, client, vaultK8sAuthPath, role.Name); err != nil {
+					return false, err
+				}
+			}
+			delete(l.entries, role.Name)
+		}
+		return false, nil
+	}
+	if owner, ok := l.entries[role.Name]; ok && owner != key {
+		log.Warnf("k8s auth role '%s' of %s already belongs to %s, skipping", role.Name, key, owner)
+		return false, nil
+	}
+	if err := addRole(ctx, client, vaultK8sAuthPath, &role); err != nil {
+		return false, err
+	}
+	l.entries[role.Name] = key
+	return true, nil
+}
+
+func saKey(sa *corev1.ServiceAccount) string {
+	return sa.Namespace + "/" + sa.Name
+}
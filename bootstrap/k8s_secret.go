@@ -2,17 +2,19 @@ package bootstrap
 
 import (
 	"context"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-func getValuesFromK8sSecret(clientsetK8s *kubernetes.Clientset, secretName *string) (*string, error) {
+func getValuesFromK8sSecret(ctx context.Context, clientsetK8s kubernetes.Interface, secretName *string) (*string, error) {
 	secretClient := clientsetK8s.CoreV1().Secrets(namespace)
 	// Check if secret exists
-	secretVault, err := secretClient.Get(context.TODO(), *secretName, metav1.GetOptions{})
+	secretVault, err := secretClient.Get(ctx, *secretName, metav1.GetOptions{})
 	if err != nil {
 		log.Debug("K8s Secret not found")
 		return nil, err
@@ -21,7 +23,7 @@ func getValuesFromK8sSecret(clientsetK8s *kubernetes.Clientset, secretName *stri
 	return &vaultSecretData, nil
 }
 
-func createK8sSecret(clientsetK8s *kubernetes.Clientset, secretName *string, vaultSecretData *string) error {
+func createK8sSecret(ctx context.Context, clientsetK8s kubernetes.Interface, secretName *string, vaultSecretData *string) error {
 	secretClient := clientsetK8s.CoreV1().Secrets(namespace)
 	secret := &apiv1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -33,10 +35,80 @@ func createK8sSecret(clientsetK8s *kubernetes.Clientset, secretName *string, vau
 		},
 	}
 
-	result, err := secretClient.Create(context.TODO(), secret, metav1.CreateOptions{})
+	result, err := secretClient.Create(ctx, secret, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
 	log.Info("Created K8s secret ", result.GetObjectMeta().GetName())
+	events.jobEventf(apiv1.EventTypeNormal, reasonSecretCreated, "Created K8s secret %s", result.GetName())
+	return nil
+}
+
+// storeInitSecrets saves the root token and the unseal keys to their K8s
+// secrets. Existing secrets are left untouched.
+func storeInitSecrets(ctx context.Context, clientsetK8s kubernetes.Interface, rootToken *string, unsealKeys *[]string) error {
+	unsealKeysString := strings.Join(*unsealKeys, ";")
+	secrets := []struct {
+		name  *string
+		value *string
+	}{
+		{&vaultSecretRoot, rootToken},
+		{&vaultSecretUnseal, &unsealKeysString},
+	}
+	for _, secret := range secrets {
+		// Check if the secret exists
+		_, err := getValuesFromK8sSecret(ctx, clientsetK8s, secret.name)
+		if err == nil {
+			continue
+		}
+		// if it fails because secret is not found, create the secret
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if err := createK8sSecret(ctx, clientsetK8s, secret.name, secret.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRootToken reads the root token from the root K8s secret
+func loadRootToken(ctx context.Context, clientsetK8s kubernetes.Interface) (string, error) {
+	rootToken, err := getValuesFromK8sSecret(ctx, clientsetK8s, &vaultSecretRoot)
+	if err != nil {
+		return "", err
+	}
+	return *rootToken, nil
+}
+
+// applyK8sSecret creates the secret or replaces its data
+func applyK8sSecret(ctx context.Context, clientsetK8s kubernetes.Interface, secretNamespace, secretName string, data map[string]string) error {
+	secretClient := clientsetK8s.CoreV1().Secrets(secretNamespace)
+	existing, err := secretClient.Get(ctx, secretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret := &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   secretName,
+				Labels: map[string]string{"app.kubernetes.io/managed-by": eventComponent},
+			},
+			Type:       apiv1.SecretTypeOpaque,
+			StringData: data,
+		}
+		if _, err := secretClient.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		log.Infof("Created K8s secret %s/%s", secretNamespace, secretName)
+		events.jobEventf(apiv1.EventTypeNormal, reasonSecretCreated, "Created K8s secret %s/%s", secretNamespace, secretName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	existing.Data = nil
+	existing.StringData = data
+	if _, err := secretClient.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	log.Infof("Updated K8s secret %s/%s", secretNamespace, secretName)
 	return nil
 }
@@ -0,0 +1,114 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	tenantPrefix    = "tenant-"
+	tenantLedgerKey = "tenants.json"
+)
+
+// tenantPolicy scopes a tenant to <mount>/data/<namespace>/* of the KV v2
+// secret engine
+const tenantPolicy = `
+path "%[1]s/data/%[2]s/*" {
+	capabilities = ["create", "read", "update", "patch", "delete", "list"]
+}
+
+path "%[1]s/metadata/%[2]s/*" {
+	capabilities = ["read", "list", "delete"]
+}
+`
+
+// tenantSpec returns the policy and the role of a tenant namespace
+func tenantSpec(ns string) (policySpec, roleSpec) {
+	name := tenantPrefix + ns
+	policy := policySpec{
+		Name:  name,
+		Rules: fmt.Sprintf(tenantPolicy, vaultTenantMount, ns),
+	}
+	role := roleSpec{
+		Name:                     name,
+		ServiceAccountNames:      []string{"*"},
+		ServiceAccountNamespaces: []string{ns},
+		Policies:                 []string{name, "default"},
+	}
+	return policy, role
+}
+
+// syncTenants onboards every namespace matching VAULT_TENANT_NAMESPACE_SELECTOR
+// and removes the policy and role of tenants whose namespace is gone. Secrets
+// stored by a removed tenant are kept.
+func syncTenants(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface) error {
+	namespaces, err := clientsetK8s.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+		LabelSelector: vaultTenantNamespaceSelector,
+	})
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(ctx, clientsetK8s, tenantLedgerKey)
+	if err != nil {
+		return err
+	}
+
+	mountPath := vaultTenantMount + "/"
+	mounted, err := checkSecretEngine(ctx, client, mountPath)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		if err := enableSecretEngine(ctx, client, mountSpec{
+			Path:    mountPath,
+			Type:    "kv",
+			Options: map[string]string{"version": "2"},
+		}); err != nil {
+			return err
+		}
+	}
+
+	current := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		// A terminating namespace is cleaned up like a deleted one
+		if ns.DeletionTimestamp != nil {
+			continue
+		}
+		current[ns.Name] = true
+		policy, role := tenantSpec(ns.Name)
+		if err := addPolicy(ctx, client, policy); err != nil {
+			return err
+		}
+		if err := addRole(ctx, client, vaultK8sAuthPath, &role); err != nil {
+			return err
+		}
+		l.entries[ns.Name] = ns.Name
+		runReport.manageTenant(policy.Name, role.Name)
+	}
+
+	var removed []string
+	for ns := range l.entries {
+		if !current[ns] {
+			removed = append(removed, ns)
+		}
+	}
+	sort.Strings(removed)
+	for _, ns := range removed {
+		policy, role := tenantSpec(ns)
+		if err := deleteRole(ctx, client, vaultK8sAuthPath, role.Name); err != nil {
+			return err
+		}
+		if err := deletePolicy(ctx, client, policy.Name); err != nil {
+			return err
+		}
+		log.Infof("tenant %s removed, secrets under %s/data/%s/ are kept", ns, vaultTenantMount, ns)
+		delete(l.entries, ns)
+	}
+	return l.save(ctx, clientsetK8s)
+}
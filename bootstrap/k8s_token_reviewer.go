@@ -0,0 +1,159 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// authDelegatorRole grants the TokenReview and SubjectAccessReview
+// permissions Vault needs to verify service account tokens
+const authDelegatorRole = "system:auth-delegator"
+
+// ensureTokenReviewer creates the reviewer service account, binds it to
+// system:auth-delegator and returns its JWT. rotated is true when the JWT
+// is new and has to be written to Vault even if a reviewer JWT is set.
+func ensureTokenReviewer(ctx context.Context, clientsetK8s kubernetes.Interface) (jwt string, rotated bool, err error) {
+	if err := ensureReviewerServiceAccount(ctx, clientsetK8s); err != nil {
+		return "", false, err
+	}
+	if err := ensureReviewerBinding(ctx, clientsetK8s); err != nil {
+		return "", false, err
+	}
+	if vaultK8sAuthReviewerTokenTTL > 0 {
+		jwt, err := requestReviewerToken(ctx, clientsetK8s)
+		return jwt, true, err
+	}
+	return ensureReviewerTokenSecret(ctx, clientsetK8s)
+}
+
+func ensureReviewerServiceAccount(ctx context.Context, clientsetK8s kubernetes.Interface) error {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: vaultK8sAuthReviewerServiceAccount,
+		},
+	}
+	_, err := clientsetK8s.CoreV1().ServiceAccounts(namespace).Create(ctx, sa, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("Created token reviewer service account ", sa.Name)
+	return nil
+}
+
+func ensureReviewerBinding(ctx context.Context, clientsetK8s kubernetes.Interface) error {
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s-%s-auth-delegator", namespace, vaultK8sAuthReviewerServiceAccount),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     authDelegatorRole,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      vaultK8sAuthReviewerServiceAccount,
+			Namespace: namespace,
+		}},
+	}
+	_, err := clientsetK8s.RbacV1().ClusterRoleBindings().Create(ctx, binding, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("Created cluster role binding ", binding.Name)
+	return nil
+}
+
+// requestReviewerToken issues a bound token with the TokenRequest API. Every
+// run gets a fresh token, so running the job more often than the TTL rotates it.
+func requestReviewerToken(ctx context.Context, clientsetK8s kubernetes.Interface) (string, error) {
+	expiration := int64(vaultK8sAuthReviewerTokenTTL.Seconds())
+	tr := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expiration,
+		},
+	}
+	result, err := clientsetK8s.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, vaultK8sAuthReviewerServiceAccount, tr, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Requested token reviewer token valid until %s", result.Status.ExpirationTimestamp)
+	return result.Status.Token, nil
+}
+
+// ensureReviewerTokenSecret returns the long-lived token of the reviewer
+// service account. With rotation enabled the secret is recreated, which
+// invalidates the previous token.
+func ensureReviewerTokenSecret(ctx context.Context, clientsetK8s kubernetes.Interface) (string, bool, error) {
+	secrets := clientsetK8s.CoreV1().Secrets(namespace)
+	name := vaultK8sAuthReviewerServiceAccount + "-token"
+
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		existing = nil
+	case err != nil:
+		return "", false, err
+	case vaultK8sAuthReviewerRotate:
+		log.Info("Rotating token reviewer secret ", name)
+		err := secrets.Delete(ctx, name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &existing.UID},
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return "", false, err
+		}
+		existing = nil
+	}
+
+	rotated := false
+	if existing == nil {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Annotations: map[string]string{
+					corev1.ServiceAccountNameKey: vaultK8sAuthReviewerServiceAccount,
+				},
+			},
+			Type: corev1.SecretTypeServiceAccountToken,
+		}
+		if err := retry(ctx, "token reviewer: create secret", func(ctx context.Context) (bool, error) {
+			// A deleted secret may still be terminating
+			_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return err == nil, err
+		}); err != nil {
+			return "", false, err
+		}
+		log.Info("Created token reviewer secret ", name)
+		events.jobEventf(corev1.EventTypeNormal, reasonSecretCreated, "Created K8s secret %s", name)
+		rotated = true
+	}
+
+	// The token controller fills in the token asynchronously
+	var jwt string
+	err = retry(ctx, "token reviewer: wait for token", func(ctx context.Context) (bool, error) {
+		secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		jwt = string(secret.Data[corev1.ServiceAccountTokenKey])
+		return jwt != "", nil
+	})
+	return jwt, rotated, err
+}
@@ -0,0 +1,206 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var vaultBootstrapGVR = schema.GroupVersionResource{
+	Group:    "vault-bootstrap.spirkaa.github.io",
+	Version:  "v1alpha1",
+	Resource: "vaultbootstraps",
+}
+
+// Condition types of the VaultBootstrap status
+const (
+	conditionInitialized    = "Initialized"
+	conditionUnsealed       = "Unsealed"
+	conditionAuthConfigured = "AuthConfigured"
+)
+
+// bootstrapStatus is the status of the VaultBootstrap custom resource
+type bootstrapStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	Nodes              []nodeReport       `json:"nodes,omitempty"`
+	LastError          string             `json:"lastError,omitempty"`
+}
+
+// nodeReport is the serializable form of nodeStatus
+type nodeReport struct {
+	Name        string `json:"name"`
+	Initialized bool   `json:"initialized"`
+	Sealed      bool   `json:"sealed"`
+	Standby     bool   `json:"standby"`
+	Leader      bool   `json:"leader"`
+	Version     string `json:"version,omitempty"`
+	ClusterID   string `json:"clusterID,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (s nodeStatus) report() nodeReport {
+	r := nodeReport{
+		Name:        s.name,
+		Initialized: s.initialized,
+		Sealed:      s.sealed,
+		Standby:     s.standby,
+		Leader:      s.leader,
+		Version:     s.version,
+		ClusterID:   s.clusterID,
+	}
+	if s.err != nil {
+		r.Error = s.err.Error()
+	}
+	return r
+}
+
+// vaultBootstrapReconciler applies VaultBootstrap resources and records the
+// outcome in their status
+type vaultBootstrapReconciler struct {
+	clientsetK8s  kubernetes.Interface
+	dynamicClient dynamic.Interface
+}
+
+// reconcile initializes, unseals and configures the cluster declared by the
+// resource and updates its status
+func (r *vaultBootstrapReconciler) reconcile(ctx context.Context, obj *unstructured.Unstructured) error {
+	obj = obj.DeepCopy()
+	var spec bootstrapSpec
+	if rawSpec, ok := obj.Object["spec"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawSpec, &spec); err != nil {
+			return fmt.Errorf("%s: invalid spec: %w", obj.GetName(), err)
+		}
+	}
+	spec = spec.withDefaults()
+
+	var status bootstrapStatus
+	if rawStatus, ok := obj.Object["status"].(map[string]interface{}); ok {
+		// A broken status is replaced as a whole below
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status)
+	}
+	status.ObservedGeneration = obj.GetGeneration()
+
+	vaultPods, applyErr := newVaultPods(spec.Members)
+	if applyErr == nil {
+		applyErr = r.apply(ctx, spec, vaultPods, &status)
+		status.Nodes = nil
+		for _, s := range collectNodeStatus(ctx, vaultPods) {
+			status.Nodes = append(status.Nodes, s.report())
+		}
+	}
+	status.LastError = ""
+	if applyErr != nil {
+		status.LastError = applyErr.Error()
+	}
+
+	if err := r.updateStatus(ctx, obj, status); err != nil {
+		return errors.Join(applyErr, err)
+	}
+	return applyErr
+}
+
+// apply runs the bootstrap steps in order and sets a condition for each of
+// them. It stops at the first failing step.
+func (r *vaultBootstrapReconciler) apply(ctx context.Context, spec bootstrapSpec, vaultPods []vaultPod, status *bootstrapStatus) error {
+	leader := vaultPods[0]
+	statuses := make(map[string]nodeStatus, len(vaultPods))
+	for _, s := range collectNodeStatus(ctx, vaultPods) {
+		statuses[s.name] = s
+	}
+	leaderStatus := statuses[leader.name]
+	if leaderStatus.err != nil {
+		setCondition(status, conditionInitialized, leaderStatus.err)
+		return leaderStatus.err
+	}
+
+	var unsealKeys []string
+	if !leaderStatus.initialized {
+		rootToken, keys, err := operatorInit(ctx, leader, spec.KeyShares, spec.KeyThreshold)
+		if err == nil {
+			err = storeInitSecrets(ctx, r.clientsetK8s, rootToken, keys)
+		}
+		if err != nil {
+			setCondition(status, conditionInitialized, err)
+			return err
+		}
+		unsealKeys = *keys
+	}
+	setCondition(status, conditionInitialized, nil)
+
+	err := func() error {
+		if unsealKeys == nil {
+			keys, err := loadUnsealKeys(ctx, r.clientsetK8s)
+			if err != nil {
+				return fmt.Errorf("cannot load unseal keys: %w", err)
+			}
+			unsealKeys = keys
+		}
+		if _, err := unsealMember(ctx, leader, unsealKeys); err != nil {
+			return err
+		}
+		return joinAndUnsealFollowers(ctx, leader, vaultPods[1:], statuses, unsealKeys)
+	}()
+	setCondition(status, conditionUnsealed, err)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		rootToken, err := loadRootToken(ctx, r.clientsetK8s)
+		if err != nil {
+			return fmt.Errorf("cannot load root token: %w", err)
+		}
+		client, err := leader.client.Clone()
+		if err != nil {
+			return err
+		}
+		client.SetToken(rootToken)
+		if err := checkVaultUp(ctx, client); err != nil {
+			return err
+		}
+		return configureVault(ctx, client, r.clientsetK8s, spec)
+	}()
+	setCondition(status, conditionAuthConfigured, err)
+	return err
+}
+
+func setCondition(status *bootstrapStatus, conditionType string, err error) {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: status.ObservedGeneration,
+		Reason:             "Succeeded",
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Failed"
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+func (r *vaultBootstrapReconciler) updateStatus(ctx context.Context, obj *unstructured.Unstructured, status bootstrapStatus) error {
+	rawStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(obj.Object, rawStatus, "status"); err != nil {
+		return err
+	}
+	_, err = r.dynamicClient.Resource(vaultBootstrapGVR).Namespace(obj.GetNamespace()).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("%s: cannot update status: %w", obj.GetName(), err)
+	}
+	log.Debugf("%s: status updated", obj.GetName())
+	return nil
+}
@@ -0,0 +1,215 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeVault serves the endpoints a reconcile of an initialized single node
+// cluster calls. sealed controls the seal state it reports.
+func fakeVault(t *testing.T, sealed bool) *httptest.Server {
+	t.Helper()
+	respond := func(w http.ResponseWriter, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			t.Error(err)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/sys/health":
+			respond(w, map[string]interface{}{
+				"initialized": true,
+				"sealed":      sealed,
+				"standby":     false,
+				"version":     "1.17.0",
+				"cluster_id":  "test-cluster",
+			})
+		case r.URL.Path == "/v1/sys/seal-status":
+			respond(w, map[string]interface{}{"initialized": true, "sealed": sealed, "t": 1, "n": 1})
+		case r.URL.Path == "/v1/sys/policies/acl":
+			respond(w, map[string]interface{}{"data": map[string]interface{}{"keys": []string{"default", "root"}}})
+		case r.URL.Path == "/v1/sys/auth":
+			respond(w, map[string]interface{}{"data": map[string]interface{}{
+				"kubernetes/": map[string]interface{}{"type": "kubernetes", "accessor": "auth_kubernetes_test"},
+			}})
+		case r.URL.Path == "/v1/auth/kubernetes/config" && r.Method == http.MethodGet:
+			respond(w, map[string]interface{}{"data": map[string]interface{}{"kubernetes_host": vaultK8sAuthKubernetesHost}})
+		case r.Method == http.MethodPut || r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newVaultBootstrap(members ...string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": vaultBootstrapGVR.GroupVersion().String(),
+		"kind":       "VaultBootstrap",
+		"metadata": map[string]interface{}{
+			"name":       "vault",
+			"namespace":  namespace,
+			"generation": int64(3),
+		},
+		"spec": map[string]interface{}{},
+	}}
+	if len(members) > 0 {
+		list := make([]interface{}, len(members))
+		for i, m := range members {
+			list[i] = m
+		}
+		obj.Object["spec"].(map[string]interface{})["members"] = list
+	}
+	return obj
+}
+
+func newReconciler(t *testing.T, obj *unstructured.Unstructured, k8sObjects ...runtime.Object) *vaultBootstrapReconciler {
+	t.Helper()
+	// Fail fast instead of retrying unreachable members
+	t.Setenv("VAULT_MAX_RETRIES", "0")
+	scheme := runtime.NewScheme()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{vaultBootstrapGVR: "VaultBootstrapList"}, obj)
+	return &vaultBootstrapReconciler{
+		clientsetK8s:  k8sfake.NewSimpleClientset(k8sObjects...),
+		dynamicClient: dynamicClient,
+	}
+}
+
+// storedStatus reads the status back from the fake API server
+func storedStatus(t *testing.T, r *vaultBootstrapReconciler) bootstrapStatus {
+	t.Helper()
+	obj, err := r.dynamicClient.Resource(vaultBootstrapGVR).Namespace(namespace).Get(context.Background(), "vault", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawStatus, ok := obj.Object["status"].(map[string]interface{})
+	if !ok {
+		t.Fatal("status not written")
+	}
+	var status bootstrapStatus
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func assertCondition(t *testing.T, status bootstrapStatus, conditionType string, want metav1.ConditionStatus) {
+	t.Helper()
+	c := meta.FindStatusCondition(status.Conditions, conditionType)
+	switch {
+	case c == nil && want != "":
+		t.Errorf("condition %s missing, want %s", conditionType, want)
+	case c != nil && want == "":
+		t.Errorf("condition %s = %s, want none", conditionType, c.Status)
+	case c != nil && c.Status != want:
+		t.Errorf("condition %s = %s (%s), want %s", conditionType, c.Status, c.Message, want)
+	case c != nil && c.ObservedGeneration != 3:
+		t.Errorf("condition %s observedGeneration = %d, want 3", conditionType, c.ObservedGeneration)
+	}
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	obj := newVaultBootstrap()
+	obj.Object["spec"] = map[string]interface{}{"keyShares": "five"}
+	r := newReconciler(t, obj)
+
+	err := r.reconcile(context.Background(), obj)
+	if err == nil || !strings.Contains(err.Error(), "invalid spec") {
+		t.Fatalf("err = %v, want invalid spec", err)
+	}
+}
+
+func TestReconcileLeaderUnreachable(t *testing.T) {
+	server := fakeVault(t, false)
+	server.Close()
+	obj := newVaultBootstrap(server.URL)
+	r := newReconciler(t, obj)
+
+	if err := r.reconcile(context.Background(), obj); err == nil {
+		t.Fatal("expected an error")
+	}
+	status := storedStatus(t, r)
+	assertCondition(t, status, conditionInitialized, metav1.ConditionFalse)
+	assertCondition(t, status, conditionUnsealed, "")
+	assertCondition(t, status, conditionAuthConfigured, "")
+	if status.LastError == "" {
+		t.Error("lastError not set")
+	}
+	if status.ObservedGeneration != 3 {
+		t.Errorf("observedGeneration = %d, want 3", status.ObservedGeneration)
+	}
+	if len(status.Nodes) != 1 || status.Nodes[0].Error == "" {
+		t.Errorf("nodes = %+v, want one node with an error", status.Nodes)
+	}
+}
+
+func TestReconcileMissingUnsealKeys(t *testing.T) {
+	server := fakeVault(t, true)
+	obj := newVaultBootstrap(server.URL)
+	r := newReconciler(t, obj)
+
+	err := r.reconcile(context.Background(), obj)
+	if err == nil || !strings.Contains(err.Error(), "cannot load unseal keys") {
+		t.Fatalf("err = %v, want cannot load unseal keys", err)
+	}
+	status := storedStatus(t, r)
+	assertCondition(t, status, conditionInitialized, metav1.ConditionTrue)
+	assertCondition(t, status, conditionUnsealed, metav1.ConditionFalse)
+	assertCondition(t, status, conditionAuthConfigured, "")
+	if !strings.Contains(status.LastError, "cannot load unseal keys") {
+		t.Errorf("lastError = %q", status.LastError)
+	}
+	if len(status.Nodes) != 1 || !status.Nodes[0].Sealed {
+		t.Errorf("nodes = %+v, want one sealed node", status.Nodes)
+	}
+}
+
+func TestReconcileConfigured(t *testing.T) {
+	server := fakeVault(t, false)
+	obj := newVaultBootstrap(server.URL)
+	// A previous failure is cleared by a successful run
+	obj.Object["status"] = map[string]interface{}{"lastError": "previous failure"}
+	defer func(host string) { vaultK8sAuthKubernetesHost = host }(vaultK8sAuthKubernetesHost)
+	vaultK8sAuthKubernetesHost = "https://kubernetes.default.svc:443"
+	rootToken := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: vaultSecretRoot, Namespace: namespace},
+		Data:       map[string][]byte{"vaultData": []byte("root-token")},
+	}
+	unsealKeys := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: vaultSecretUnseal, Namespace: namespace},
+		Data:       map[string][]byte{"vaultData": []byte("unseal-key")},
+	}
+	r := newReconciler(t, obj, rootToken, unsealKeys)
+
+	if err := r.reconcile(context.Background(), obj); err != nil {
+		t.Fatal(err)
+	}
+	status := storedStatus(t, r)
+	assertCondition(t, status, conditionInitialized, metav1.ConditionTrue)
+	assertCondition(t, status, conditionUnsealed, metav1.ConditionTrue)
+	assertCondition(t, status, conditionAuthConfigured, metav1.ConditionTrue)
+	if status.LastError != "" {
+		t.Errorf("lastError = %q, want none", status.LastError)
+	}
+	if len(status.Nodes) != 1 || !status.Nodes[0].Leader || status.Nodes[0].Version != "1.17.0" {
+		t.Errorf("nodes = %+v, want one leader node", status.Nodes)
+	}
+}
@@ -1,50 +1,122 @@
 package bootstrap
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
-	"time"
+	"strings"
+	"text/tabwriter"
 
+	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 )
 
-var vaultReadyStatusCodes = []int{200, 501, 503, 429, 472, 473}
-
-func find(slice []int, val int) bool {
-	for _, item := range slice {
-		if item == val {
-			return true
-		}
-	}
-	return false
+// Query parameters for sys/health that make every reachable node answer with
+// 200, whatever its state, so the body can be parsed
+var vaultHealthParams = map[string]string{
+	"standbyok":     "true",
+	"perfstandbyok": "true",
+	"sealedcode":    "200",
+	"uninitcode":    "200",
 }
 
-func preflight(vaultPods []vaultPod) {
-	c := make(chan string, len(vaultPods))
+// preflight waits until every member answers sys/health and returns the
+// reported status of each of them, keyed by pod name
+func preflight(ctx context.Context, vaultPods []vaultPod) (map[string]nodeStatus, error) {
+	type result struct {
+		status nodeStatus
+		err    error
+	}
+	c := make(chan result, len(vaultPods))
 	for _, pod := range vaultPods {
 		log.Debugf("Starting goroutine for %s", pod.name)
-		go checkVaultStatus(pod, c)
+		go func(pod vaultPod) {
+			status, err := checkVaultStatus(ctx, pod)
+			c <- result{status, err}
+		}(pod)
 	}
+	statuses := make(map[string]nodeStatus, len(vaultPods))
+	var errs []error
 	for range vaultPods {
-		log.Infof("%s is Running", <-c)
+		r := <-c
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		statuses[r.status.name] = r.status
 	}
+	return statuses, errors.Join(errs...)
 }
 
-func checkVaultStatus(pod vaultPod, c chan string) {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	for {
-		resp, err := http.Get(pod.fqdn + "/v1/sys/health")
-		if err != nil {
-			log.Debugf("%s: %s", pod.name, err.Error())
-			time.Sleep(1 * time.Second)
-			continue
-		} else if !find(vaultReadyStatusCodes, resp.StatusCode) {
-			log.Debugf("%s: HTTP Status %s", pod.name, strconv.Itoa(resp.StatusCode))
-			time.Sleep(1 * time.Second)
+func checkVaultStatus(ctx context.Context, pod vaultPod) (nodeStatus, error) {
+	var status nodeStatus
+	err := retry(ctx, pod.name+": preflight", func(ctx context.Context) (bool, error) {
+		var err error
+		status, err = getNodeStatus(ctx, pod)
+		return err == nil, err
+	})
+	if err != nil {
+		return status, err
+	}
+	log.Infof("%s is Running", pod.name)
+	return status, nil
+}
+
+// getNodeStatus queries sys/health of a single member once
+func getNodeStatus(ctx context.Context, pod vaultPod) (nodeStatus, error) {
+	status := nodeStatus{name: pod.name}
+	req := pod.client.NewRequest(http.MethodGet, "/v1/sys/health")
+	for k, v := range vaultHealthParams {
+		req.Params.Set(k, v)
+	}
+	resp, err := pod.client.RawRequestWithContext(ctx, req)
+	if resp == nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("HTTP Status %d", resp.StatusCode)
+	}
+	var health vault.HealthResponse
+	if err := resp.DecodeJSON(&health); err != nil {
+		return status, fmt.Errorf("cannot parse sys/health response: %w", err)
+	}
+	status.initialized = health.Initialized
+	status.sealed = health.Sealed
+	status.standby = health.Standby || health.PerformanceStandby
+	status.leader = status.initialized && !status.sealed && !status.standby
+	status.version = health.Version
+	status.clusterID = health.ClusterID
+	log.Debugf("%s: initialized=%t sealed=%t standby=%t version=%s", pod.name, status.initialized, status.sealed, status.standby, status.version)
+	return status, nil
+}
+
+// collectNodeStatus queries every member once, without retrying. Members
+// that cannot be reached are reported with their error.
+func collectNodeStatus(ctx context.Context, vaultPods []vaultPod) []nodeStatus {
+	statuses := make([]nodeStatus, len(vaultPods))
+	for i, pod := range vaultPods {
+		status, err := getNodeStatus(ctx, pod)
+		status.err = err
+		statuses[i] = status
+	}
+	return statuses
+}
+
+func logNodeStatus(statuses []nodeStatus) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tINITIALIZED\tSEALED\tSTANDBY\tLEADER\tVERSION\tCLUSTER ID")
+	for _, s := range statuses {
+		if s.err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t%s\n", s.name, s.err.Error())
 			continue
 		}
-		c <- pod.name
-		break
+		fmt.Fprintf(w, "%s\t%t\t%t\t%t\t%t\t%s\t%s\n", s.name, s.initialized, s.sealed, s.standby, s.leader, s.version, s.clusterID)
+	}
+	w.Flush()
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		log.Info(line)
 	}
 }
@@ -0,0 +1,67 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryPolicy controls how wait loops back off between attempts
+type retryPolicy struct {
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	multiplier      float64
+	jitter          float64
+	stepTimeout     time.Duration
+}
+
+// interval returns the backoff before the given attempt (starting at 0),
+// randomized by +/- jitter
+func (p retryPolicy) interval(attempt int) time.Duration {
+	d := float64(p.initialInterval)
+	for i := 0; i < attempt; i++ {
+		d *= p.multiplier
+		if d >= float64(p.maxInterval) {
+			d = float64(p.maxInterval)
+			break
+		}
+	}
+	if p.jitter > 0 {
+		d += d * p.jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// retry calls fn until it reports done, the step timeout expires or ctx is
+// cancelled. fn is retried while it returns done == false; the error it
+// returns alongside is logged and reported if the step gives up. When fn
+// returns done == true its error is returned as is.
+func retry(ctx context.Context, step string, fn func(ctx context.Context) (bool, error)) error {
+	if vaultRetryPolicy.stepTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vaultRetryPolicy.stepTimeout)
+		defer cancel()
+	}
+	for attempt := 0; ; attempt++ {
+		done, err := fn(ctx)
+		if done {
+			return err
+		}
+		if err != nil {
+			log.Debugf("%s: %s", step, err.Error())
+		}
+		wait := vaultRetryPolicy.interval(attempt)
+		log.Debugf("%s: attempt %d failed, retrying in %s", step, attempt+1, wait)
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("%s: giving up after %d attempts: %w (last error: %s)", step, attempt+1, ctx.Err(), err.Error())
+			}
+			return fmt.Errorf("%s: giving up after %d attempts: %w", step, attempt+1, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
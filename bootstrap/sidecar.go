@@ -0,0 +1,112 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sidecar keeps the Vault container it runs next to joined and unsealed
+type sidecar struct {
+	local      vaultPod
+	leader     vaultPod
+	unsealKeys *unsealKeyCache
+
+	unsealed  atomic.Bool
+	lastCheck atomic.Int64
+}
+
+// Sidecar runs next to a single Vault container until ctx is cancelled
+func Sidecar(ctx context.Context) {
+	clientsetK8s, err := newK8sClientset()
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	startEvents(ctx, clientsetK8s)
+	if err := loadVaultTLSFromSecret(ctx, clientsetK8s); err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	pods, err := newVaultPods([]string{vaultSidecarAddr, strings.Split(vaultClusterMembers, ",")[0]})
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	s := &sidecar{
+		local:      pods[0],
+		leader:     pods[1],
+		unsealKeys: &unsealKeyCache{clientsetK8s: clientsetK8s},
+	}
+	// The local address usually is localhost, so name it after the pod
+	if hostname, err := os.Hostname(); err == nil {
+		s.local.name = hostname
+	}
+
+	s.lastCheck.Store(time.Now().Unix())
+	server := &http.Server{Addr: vaultSidecarListenAddr, Handler: s.handler()}
+	go func() {
+		log.Infof("sidecar: serving health endpoints on %s", vaultSidecarListenAddr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+	}()
+
+	ticker := time.NewTicker(vaultSidecarInterval)
+	defer ticker.Stop()
+	for {
+		s.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			log.Info("sidecar: shutting down")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile checks the local node once and joins or unseals it if needed
+func (s *sidecar) reconcile(ctx context.Context) {
+	defer s.lastCheck.Store(time.Now().Unix())
+
+	if _, err := ensureMemberUnsealed(ctx, s.local, s.leader, s.unsealKeys.load); err != nil {
+		log.Warn(err.Error())
+		s.unsealKeys.reset()
+		s.unsealed.Store(false)
+		return
+	}
+	s.unsealed.Store(true)
+}
+
+// handler serves /healthz, healthy while the check loop is running, and
+// /readyz, ready while the local node is unsealed
+func (s *sidecar) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		last := time.Unix(s.lastCheck.Load(), 0)
+		if time.Since(last) > 3*vaultSidecarInterval+vaultRetryPolicy.stepTimeout {
+			http.Error(w, "check loop stalled", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.unsealed.Load() {
+			http.Error(w, "sealed", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
@@ -0,0 +1,222 @@
+package bootstrap
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// bootstrapSpec declares the desired state of a Vault cluster. It is the
+// spec of the VaultBootstrap custom resource and the format of
+// VAULT_BOOTSTRAP_SPEC_FILE.
+type bootstrapSpec struct {
+	// Members are the URLs of the cluster members, the first one is
+	// initialized and unsealed first
+	Members      []string         `json:"members,omitempty"`
+	KeyShares    int              `json:"keyShares,omitempty"`
+	KeyThreshold int              `json:"keyThreshold,omitempty"`
+	Policies     []policySpec     `json:"policies,omitempty"`
+	Roles        []roleSpec       `json:"roles,omitempty"`
+	Mounts       []mountSpec      `json:"mounts,omitempty"`
+	AuthMethods  []authMethodSpec `json:"authMethods,omitempty"`
+	Clusters     []clusterSpec    `json:"clusters,omitempty"`
+	AppRoles     []appRoleSpec    `json:"appRoles,omitempty"`
+	JWTAuth      []jwtAuthSpec    `json:"jwtAuth,omitempty"`
+	LDAPAuth     []ldapAuthSpec   `json:"ldapAuth,omitempty"`
+}
+
+// policySpec is an ACL policy. With Template set, Rules is a Go text/template
+// rendered with the other fields as variables.
+type policySpec struct {
+	Name      string `json:"name"`
+	Rules     string `json:"rules"`
+	Template  bool   `json:"template,omitempty"`
+	Mount     string `json:"mount,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// roleSpec is a role of the kubernetes auth method. Checks are verified by
+// the smoke test.
+type roleSpec struct {
+	Name                     string            `json:"name"`
+	ServiceAccountNames      []string          `json:"serviceAccountNames"`
+	ServiceAccountNamespaces []string          `json:"serviceAccountNamespaces"`
+	Policies                 []string          `json:"policies,omitempty"`
+	TTL                      string            `json:"ttl,omitempty"`
+	Checks                   []capabilityCheck `json:"checks,omitempty"`
+}
+
+// capabilityCheck lists capabilities a role must have on a path
+type capabilityCheck struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// clusterSpec is a remote Kubernetes cluster authenticating against Vault
+// through its own kubernetes auth mount. Secret is a K8s secret holding
+// either a `kubeconfig` or `host`, `ca.crt` and `token`.
+type clusterSpec struct {
+	Name   string     `json:"name"`
+	Path   string     `json:"path,omitempty"`
+	Secret string     `json:"secret"`
+	Roles  []roleSpec `json:"roles,omitempty"`
+}
+
+// appRoleSpec is a role of the AppRole auth method. Its role_id and a
+// secret_id, response-wrapped with WrapTTL if set, are written to the K8s
+// secret Secret in SecretNamespace.
+type appRoleSpec struct {
+	Name               string   `json:"name"`
+	Policies           []string `json:"policies,omitempty"`
+	TokenTTL           string   `json:"tokenTTL,omitempty"`
+	TokenMaxTTL        string   `json:"tokenMaxTTL,omitempty"`
+	TokenBoundCIDRs    []string `json:"tokenBoundCIDRs,omitempty"`
+	SecretIDTTL        string   `json:"secretIDTTL,omitempty"`
+	SecretIDNumUses    int      `json:"secretIDNumUses,omitempty"`
+	SecretIDBoundCIDRs []string `json:"secretIDBoundCIDRs,omitempty"`
+	Secret             string   `json:"secret,omitempty"`
+	SecretNamespace    string   `json:"secretNamespace,omitempty"`
+	WrapTTL            string   `json:"wrapTTL,omitempty"`
+}
+
+// jwtAuthSpec is a jwt auth method, e.g. for CI pipelines, or with Type oidc
+// an OIDC auth method for human operators. Groups map values of the groups
+// claim to policies.
+type jwtAuthSpec struct {
+	Path                 string              `json:"path,omitempty"`
+	Type                 string              `json:"type,omitempty"`
+	Description          string              `json:"description,omitempty"`
+	OIDCDiscoveryURL     string              `json:"oidcDiscoveryURL,omitempty"`
+	OIDCDiscoveryCAPEM   string              `json:"oidcDiscoveryCAPEM,omitempty"`
+	OIDCClientID         string              `json:"oidcClientID,omitempty"`
+	OIDCClientSecret     *secretKeyRef       `json:"oidcClientSecret,omitempty"`
+	JWKSURL              string              `json:"jwksURL,omitempty"`
+	JWKSCAPEM            string              `json:"jwksCAPEM,omitempty"`
+	JWTValidationPubkeys []string            `json:"jwtValidationPubkeys,omitempty"`
+	BoundIssuer          string              `json:"boundIssuer,omitempty"`
+	DefaultRole          string              `json:"defaultRole,omitempty"`
+	Roles                []jwtRoleSpec       `json:"roles,omitempty"`
+	Groups               []identityGroupSpec `json:"groups,omitempty"`
+}
+
+// ldapAuthSpec is an ldap auth method. BindPass is read from a K8s secret,
+// Certificate is the PEM-encoded CA of the LDAP server.
+type ldapAuthSpec struct {
+	Path        string          `json:"path,omitempty"`
+	Description string          `json:"description,omitempty"`
+	URL         string          `json:"url"`
+	StartTLS    bool            `json:"startTLS,omitempty"`
+	Certificate string          `json:"certificate,omitempty"`
+	BindDN      string          `json:"bindDN,omitempty"`
+	BindPass    *secretKeyRef   `json:"bindPass,omitempty"`
+	UserDN      string          `json:"userDN,omitempty"`
+	UserAttr    string          `json:"userAttr,omitempty"`
+	UPNDomain   string          `json:"upnDomain,omitempty"`
+	GroupDN     string          `json:"groupDN,omitempty"`
+	GroupFilter string          `json:"groupFilter,omitempty"`
+	GroupAttr   string          `json:"groupAttr,omitempty"`
+	Groups      []ldapGroupSpec `json:"groups,omitempty"`
+}
+
+// ldapGroupSpec maps an LDAP group to policies
+type ldapGroupSpec struct {
+	Name     string   `json:"name"`
+	Policies []string `json:"policies,omitempty"`
+}
+
+// secretKeyRef is a key of a K8s secret in the namespace of the tool
+type secretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// identityGroupSpec is an external identity group. Alias is the name of the
+// group at the identity provider and defaults to Name.
+type identityGroupSpec struct {
+	Name     string   `json:"name"`
+	Alias    string   `json:"alias,omitempty"`
+	Policies []string `json:"policies,omitempty"`
+}
+
+type jwtRoleSpec struct {
+	Name                string                 `json:"name"`
+	RoleType            string                 `json:"roleType,omitempty"`
+	UserClaim           string                 `json:"userClaim"`
+	GroupsClaim         string                 `json:"groupsClaim,omitempty"`
+	BoundAudiences      []string               `json:"boundAudiences,omitempty"`
+	BoundSubject        string                 `json:"boundSubject,omitempty"`
+	BoundClaims         map[string]interface{} `json:"boundClaims,omitempty"`
+	BoundClaimsType     string                 `json:"boundClaimsType,omitempty"`
+	ClaimMappings       map[string]string      `json:"claimMappings,omitempty"`
+	AllowedRedirectURIs []string               `json:"allowedRedirectURIs,omitempty"`
+	OIDCScopes          []string               `json:"oidcScopes,omitempty"`
+	Policies            []string               `json:"policies,omitempty"`
+	TTL                 string                 `json:"ttl,omitempty"`
+	MaxTTL              string                 `json:"maxTTL,omitempty"`
+}
+
+// mountSpec is a secret engine
+type mountSpec struct {
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`
+}
+
+// authMethodSpec is an auth method besides the kubernetes one. Config, if
+// set, is written to auth/<path>/config.
+type authMethodSpec struct {
+	Path        string                 `json:"path"`
+	Type        string                 `json:"type"`
+	Description string                 `json:"description,omitempty"`
+	Config      map[string]interface{} `json:"config,omitempty"`
+}
+
+// defaultSpec returns the spec built from the environment and the built-in
+// policy, roles and secret engine
+func defaultSpec() bootstrapSpec {
+	return bootstrapSpec{
+		Members:      strings.Split(vaultClusterMembers, ","),
+		KeyShares:    vaultKeyShares,
+		KeyThreshold: vaultKeyThreshold,
+		Policies:     []policySpec{{Name: policyName, Rules: policyDef}},
+		Roles:        saRoles,
+		Mounts:       []mountSpec{{Path: "secret/", Type: "kv-v2"}},
+	}
+}
+
+// loadSpec returns the default spec overridden by every field set in
+// VAULT_BOOTSTRAP_SPEC_FILE
+func loadSpec() (bootstrapSpec, error) {
+	spec := defaultSpec()
+	if vaultBootstrapSpecFile == "" {
+		return spec, nil
+	}
+	data, err := os.ReadFile(vaultBootstrapSpecFile)
+	if err != nil {
+		return spec, err
+	}
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return spec, fmt.Errorf("cannot parse %s: %w", vaultBootstrapSpecFile, err)
+	}
+	return spec, nil
+}
+
+// withDefaults fills the fields left empty in a VaultBootstrap resource
+func (s bootstrapSpec) withDefaults() bootstrapSpec {
+	d := defaultSpec()
+	if len(s.Members) == 0 {
+		s.Members = d.Members
+	}
+	if s.KeyShares == 0 {
+		s.KeyShares = d.KeyShares
+	}
+	if s.KeyThreshold == 0 {
+		s.KeyThreshold = d.KeyThreshold
+	}
+	return s
+}
@@ -8,8 +8,14 @@ type vaultPod struct {
 	client *vault.Client
 }
 
-type vaultSaRole struct {
+// nodeStatus is the state of a member as reported by sys/health
+type nodeStatus struct {
 	name        string
-	saName      string
-	saNamespace string
+	initialized bool
+	sealed      bool
+	standby     bool
+	leader      bool
+	version     string
+	clusterID   string
+	err         error
 }
@@ -0,0 +1,195 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// builtinPolicies exist in every Vault
+var builtinPolicies = []string{"default", "root"}
+
+// specFindings are the problems found in a spec
+type specFindings struct {
+	errors   []string
+	warnings []string
+}
+
+func (f *specFindings) errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *specFindings) warnf(format string, args ...interface{}) {
+	f.warnings = append(f.warnings, fmt.Sprintf(format, args...))
+}
+
+// err returns the errors as one error, nil if there are none
+func (f *specFindings) err() error {
+	if len(f.errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid spec: %d error(s), first: %s", len(f.errors), f.errors[0])
+}
+
+// Validate checks the spec offline and exits with 1 if it has errors, or
+// warnings when VAULT_VALIDATE_STRICT is set
+func Validate(ctx context.Context) {
+	spec, err := loadSpec()
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	findings := validateSpec(spec, nil)
+	for _, w := range findings.warnings {
+		log.Warn(w)
+	}
+	for _, e := range findings.errors {
+		log.Error(e)
+	}
+	if len(findings.errors) > 0 || (vaultValidateStrict && len(findings.warnings) > 0) {
+		log.Errorf("Validation failed: %d error(s), %d warning(s)", len(findings.errors), len(findings.warnings))
+		os.Exit(1)
+	}
+	log.Infof("Validation passed: %d policies, %d roles, %d warning(s)", len(spec.Policies), len(spec.Roles), len(findings.warnings))
+}
+
+// validateSpec lints the policies of the spec and checks that every role
+// refers to a policy that is declared, built in or in existingPolicies
+func validateSpec(spec bootstrapSpec, existingPolicies []string) *specFindings {
+	findings := &specFindings{}
+
+	known := map[string]bool{}
+	for _, name := range append(builtinPolicies, existingPolicies...) {
+		known[name] = true
+	}
+	declared := map[string]bool{}
+	for _, policy := range spec.Policies {
+		switch {
+		case policy.Name == "":
+			findings.errorf("policy without name")
+			continue
+		case policy.Name == "root":
+			findings.errorf("policy root cannot be modified")
+			continue
+		case declared[policy.Name]:
+			findings.errorf("policy %s: declared twice", policy.Name)
+		}
+		declared[policy.Name] = true
+		known[policy.Name] = true
+
+		rules := policy.Rules
+		if policy.Template {
+			var err error
+			// Accessors are unknown offline, any value renders the same shape
+			rules, err = renderPolicy(policy, offlineAccessor)
+			if err != nil {
+				findings.errorf("policy %s: cannot render template: %s", policy.Name, err.Error())
+				continue
+			}
+		}
+		errs, warnings := lintPolicy(rules)
+		for _, e := range errs {
+			findings.errorf("policy %s: %s", policy.Name, e)
+		}
+		for _, w := range warnings {
+			findings.warnf("policy %s: %s", policy.Name, w)
+		}
+	}
+
+	checkRoles := func(authPath string, roles []roleSpec) {
+		for _, role := range roles {
+			if role.Name == "" {
+				findings.errorf("role without name on %s/", authPath)
+				continue
+			}
+			policies := role.Policies
+			if len(policies) == 0 {
+				policies = []string{policyName, "default"}
+			}
+			for _, policy := range policies {
+				if !known[policy] {
+					findings.errorf("role %s on %s/: policy %s does not exist", role.Name, authPath, policy)
+				}
+				if policy == "root" {
+					findings.warnf("role %s on %s/: grants the root policy", role.Name, authPath)
+				}
+			}
+			for _, check := range role.Checks {
+				for _, c := range check.Capabilities {
+					if !policyCapabilities[c] {
+						findings.errorf("role %s on %s/: check of %s: unknown capability %q", role.Name, authPath, check.Path, c)
+					}
+				}
+			}
+			if len(role.ServiceAccountNames) == 0 || len(role.ServiceAccountNamespaces) == 0 {
+				findings.errorf("role %s on %s/: service account names and namespaces are required", role.Name, authPath)
+			}
+		}
+	}
+	checkRoles(vaultK8sAuthPath, spec.Roles)
+	// Tenant sync writes and prunes the roles with this prefix on the same
+	// mount
+	for _, role := range spec.Roles {
+		if strings.HasPrefix(role.Name, tenantPrefix) {
+			findings.errorf("role %s on %s/: the prefix %s is reserved for tenants", role.Name, vaultK8sAuthPath, tenantPrefix)
+		}
+	}
+	for _, method := range spec.JWTAuth {
+		if _, err := jwtAuthConfig(method); err != nil {
+			findings.errorf("%s", err.Error())
+		}
+		for _, role := range method.Roles {
+			if role.UserClaim == "" {
+				findings.errorf("role %s on %s/: userClaim is required", role.Name, method.path())
+			}
+			for _, policy := range role.Policies {
+				if !known[policy] {
+					findings.errorf("role %s on %s/: policy %s does not exist", role.Name, method.path(), policy)
+				}
+			}
+		}
+		for _, group := range method.Groups {
+			for _, policy := range group.Policies {
+				if !known[policy] {
+					findings.errorf("identity group %s: policy %s does not exist", group.Name, policy)
+				}
+			}
+		}
+	}
+	for _, method := range spec.LDAPAuth {
+		// No clientset, the bind password is not read offline
+		if _, err := ldapAuthConfig(context.Background(), nil, method); err != nil {
+			findings.errorf("ldap auth %s/: %s", method.path(), err.Error())
+		}
+		for _, group := range method.Groups {
+			for _, policy := range group.Policies {
+				if !known[policy] {
+					findings.errorf("ldap group %s on %s/: policy %s does not exist", group.Name, method.path(), policy)
+				}
+			}
+		}
+	}
+	for _, role := range spec.AppRoles {
+		for _, policy := range role.Policies {
+			if !known[policy] {
+				findings.errorf("approle %s: policy %s does not exist", role.Name, policy)
+			}
+		}
+	}
+	for _, cluster := range spec.Clusters {
+		checkRoles(cluster.authPath(), cluster.Roles)
+	}
+
+	sort.Strings(findings.warnings)
+	return findings
+}
+
+// offlineAccessor stands in for the auth mount accessors when Vault is not
+// reachable
+func offlineAccessor(mount string) (string, error) {
+	return "auth_" + strings.Trim(mount, "/") + "_accessor", nil
+}
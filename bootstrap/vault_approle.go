@@ -0,0 +1,242 @@
+package bootstrap
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of an AppRole credentials secret. A response-wrapped secret_id is
+// stored as wrapping_token instead of secret_id. The accessor is kept to
+// destroy the secret_id once it is replaced.
+const (
+	appRoleKeyRoleID           = "role_id"
+	appRoleKeySecretID         = "secret_id"
+	appRoleKeyWrappingToken    = "wrapping_token"
+	appRoleKeySecretIDAccessor = "secret_id_accessor"
+)
+
+// configureAppRoles enables the AppRole auth method, writes the roles and
+// delivers their credentials
+func configureAppRoles(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, roles []appRoleSpec) error {
+	if err := enableAuthMethod(ctx, client, authMethodSpec{Path: vaultAppRolePath, Type: "approle"}); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if err := addAppRole(ctx, client, role); err != nil {
+			return fmt.Errorf("approle %s: %w", role.Name, err)
+		}
+		if role.Secret == "" {
+			continue
+		}
+		if err := deliverAppRoleCredentials(ctx, client, clientsetK8s, role); err != nil {
+			return fmt.Errorf("approle %s: %w", role.Name, err)
+		}
+	}
+	return nil
+}
+
+func addAppRole(ctx context.Context, client *vault.Client, role appRoleSpec) error {
+	data := map[string]interface{}{
+		"token_policies":     role.Policies,
+		"secret_id_num_uses": role.SecretIDNumUses,
+	}
+	if role.TokenTTL != "" {
+		data["token_ttl"] = role.TokenTTL
+	}
+	if role.TokenMaxTTL != "" {
+		data["token_max_ttl"] = role.TokenMaxTTL
+	}
+	if role.SecretIDTTL != "" {
+		data["secret_id_ttl"] = role.SecretIDTTL
+	}
+	if len(role.SecretIDBoundCIDRs) > 0 {
+		data["secret_id_bound_cidrs"] = role.SecretIDBoundCIDRs
+	}
+	if len(role.TokenBoundCIDRs) > 0 {
+		data["token_bound_cidrs"] = role.TokenBoundCIDRs
+	}
+	path := fmt.Sprintf("auth/%s/role/%s", vaultAppRolePath, role.Name)
+	if _, err := client.Logical().WriteWithContext(ctx, path, data); err != nil {
+		return err
+	}
+	log.Infof("approle role '%s' configured", role.Name)
+	events.jobEventf(corev1.EventTypeNormal, reasonRoleWritten, "Wrote approle role %s on %s/", role.Name, vaultAppRolePath)
+	return nil
+}
+
+// deliverAppRoleCredentials writes the role_id and a new secret_id to the
+// K8s secret of the role. The secret_id is only replaced when the stored one
+// is no longer usable, and the replaced one is destroyed, so every run does
+// not pile up secret_ids.
+func deliverAppRoleCredentials(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, role appRoleSpec) error {
+	secretNamespace := role.SecretNamespace
+	if secretNamespace == "" {
+		secretNamespace = namespace
+	}
+
+	roleIDSecret, err := client.Logical().ReadWithContext(ctx, fmt.Sprintf("auth/%s/role/%s/role-id", vaultAppRolePath, role.Name))
+	if err != nil {
+		return err
+	}
+	if roleIDSecret == nil {
+		return fmt.Errorf("no role_id returned")
+	}
+	roleID, _ := roleIDSecret.Data["role_id"].(string)
+
+	existing, err := clientsetK8s.CoreV1().Secrets(secretNamespace).Get(ctx, role.Secret, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		existing = nil
+	case err != nil:
+		return err
+	}
+	if existing != nil && string(existing.Data[appRoleKeyRoleID]) == roleID {
+		valid, err := storedSecretIDValid(ctx, client, role, existing)
+		if err != nil {
+			return err
+		}
+		if valid {
+			log.Infof("approle %s: secret %s/%s is up to date", role.Name, secretNamespace, role.Secret)
+			return nil
+		}
+	}
+
+	if existing != nil {
+		if err := destroySecretID(ctx, client, role, string(existing.Data[appRoleKeySecretIDAccessor])); err != nil {
+			return err
+		}
+	}
+
+	secretIDClient := client
+	if role.WrapTTL != "" {
+		secretIDClient, err = client.Clone()
+		if err != nil {
+			return err
+		}
+		secretIDClient.SetToken(client.Token())
+		secretIDClient.SetWrappingLookupFunc(func(string, string) string { return role.WrapTTL })
+	}
+	secretID, err := secretIDClient.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/role/%s/secret-id", vaultAppRolePath, role.Name), nil)
+	if err != nil {
+		return err
+	}
+	if secretID == nil {
+		return fmt.Errorf("no secret_id returned")
+	}
+
+	data := map[string]string{appRoleKeyRoleID: roleID}
+	if role.WrapTTL != "" {
+		if secretID.WrapInfo == nil {
+			return fmt.Errorf("secret_id was not response-wrapped")
+		}
+		data[appRoleKeyWrappingToken] = secretID.WrapInfo.Token
+		data[appRoleKeySecretIDAccessor] = secretID.WrapInfo.WrappedAccessor
+	} else {
+		data[appRoleKeySecretID], _ = secretID.Data["secret_id"].(string)
+		data[appRoleKeySecretIDAccessor], _ = secretID.Data["secret_id_accessor"].(string)
+	}
+	return applyK8sSecret(ctx, clientsetK8s, secretNamespace, role.Secret, data)
+}
+
+// storedSecretIDValid reports whether the secret_id in the K8s secret can
+// still be used. It is looked up by its accessor, so a secret_id the
+// consumer already unwrapped counts as valid as long as it exists.
+func storedSecretIDValid(ctx context.Context, client *vault.Client, role appRoleSpec, secret *corev1.Secret) (bool, error) {
+	if accessor := string(secret.Data[appRoleKeySecretIDAccessor]); accessor != "" {
+		lookup, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/role/%s/secret-id-accessor/lookup", vaultAppRolePath, role.Name), map[string]interface{}{
+			"secret_id_accessor": accessor,
+		})
+		if isVaultNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return lookup != nil && lookup.Data != nil, nil
+	}
+
+	// Secrets written before the accessor was stored
+	if role.WrapTTL != "" {
+		token := string(secret.Data[appRoleKeyWrappingToken])
+		if token == "" {
+			return false, nil
+		}
+		// An unwrapped or expired wrapping token cannot be looked up
+		info, err := client.Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]interface{}{"token": token})
+		if isVaultNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return info != nil, nil
+	}
+	secretID := string(secret.Data[appRoleKeySecretID])
+	if secretID == "" {
+		return false, nil
+	}
+	lookup, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/role/%s/secret-id/lookup", vaultAppRolePath, role.Name), map[string]interface{}{
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return lookup != nil && lookup.Data != nil, nil
+}
+
+// destroySecretID destroys the secret_id with the accessor, if any. One that
+// already expired or was used up is gone anyway.
+func destroySecretID(ctx context.Context, client *vault.Client, role appRoleSpec, accessor string) error {
+	if accessor == "" {
+		return nil
+	}
+	_, err := client.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/role/%s/secret-id-accessor/destroy", vaultAppRolePath, role.Name), map[string]interface{}{
+		"secret_id_accessor": accessor,
+	})
+	if isVaultNotFound(err) {
+		log.Debugf("approle %s: previous secret_id already gone", role.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("approle %s: previous secret_id destroyed", role.Name)
+	return nil
+}
+
+// vaultNotFoundErrors are the errors Vault answers with, as 400 or 500
+// instead of 404, for an unknown wrapping token or secret_id accessor
+var vaultNotFoundErrors = []string{
+	"wrapping token is not valid or does not exist",
+	"failed to find accessor entry for secret_id_accessor",
+}
+
+// isVaultNotFound reports whether Vault rejected a request because the
+// object it refers to does not exist
+func isVaultNotFound(err error) bool {
+	var respErr *vault.ResponseError
+	if !stderrors.As(err, &respErr) {
+		return false
+	}
+	if respErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	for _, e := range respErr.Errors {
+		for _, notFound := range vaultNotFoundErrors {
+			if strings.Contains(e, notFound) {
+				return true
+			}
+		}
+	}
+	return false
+}
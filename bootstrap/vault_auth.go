@@ -0,0 +1,47 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// enableAuthMethod enables the auth method unless it is enabled already and
+// writes its config, if any
+func enableAuthMethod(ctx context.Context, client *vault.Client, method authMethodSpec) error {
+	path := strings.Trim(method.Path, "/") + "/"
+	auths, err := client.Sys().ListAuthWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if existing, ok := auths[path]; ok {
+		if existing.Type != method.Type {
+			return fmt.Errorf("auth method %s is of type %s, not %s", path, existing.Type, method.Type)
+		}
+		log.Infof("auth method %s already enabled", path)
+		runReport.addStep(reasonAuthEnabled, path, stepSkipped, "already enabled")
+	} else {
+		err := client.Sys().EnableAuthWithOptionsWithContext(ctx, path, &vault.EnableAuthOptions{
+			Type:        method.Type,
+			Description: method.Description,
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("auth method %s successfully enabled", path)
+		events.jobEventf(corev1.EventTypeNormal, reasonAuthEnabled, "Enabled auth method %s", path)
+	}
+
+	if len(method.Config) == 0 {
+		return nil
+	}
+	if _, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"config", method.Config); err != nil {
+		return err
+	}
+	log.Infof("auth method %s configured", path)
+	return nil
+}
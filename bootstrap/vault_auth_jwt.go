@@ -0,0 +1,230 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// jwtObjectsLedgerKey records the roles and identity groups written for the
+// jwt and oidc auth methods, by their Vault path
+const jwtObjectsLedgerKey = "jwt-objects.json"
+
+// path returns the mount path of the method, jwt/ or oidc/ unless set
+func (m jwtAuthSpec) path() string {
+	if m.Path != "" {
+		return strings.Trim(m.Path, "/")
+	}
+	return m.authType()
+}
+
+func (m jwtAuthSpec) authType() string {
+	if m.Type != "" {
+		return m.Type
+	}
+	return "jwt"
+}
+
+// configureJWTAuth configures the jwt and oidc auth methods and deletes the
+// roles and identity groups the tool created that are no longer declared
+func configureJWTAuth(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, methods []jwtAuthSpec) error {
+	l, err := loadLedger(ctx, clientsetK8s, jwtObjectsLedgerKey)
+	if err != nil {
+		return err
+	}
+	if len(methods) == 0 && len(l.entries) == 0 {
+		return nil
+	}
+
+	declared := map[string]bool{}
+	for _, method := range methods {
+		written, err := applyJWTAuth(ctx, client, clientsetK8s, method)
+		if err != nil {
+			return err
+		}
+		for _, object := range written {
+			declared[object] = true
+			l.entries[object] = method.path()
+		}
+	}
+
+	var removed []string
+	for object := range l.entries {
+		if !declared[object] {
+			removed = append(removed, object)
+		}
+	}
+	sort.Strings(removed)
+	for _, object := range removed {
+		if _, err := client.Logical().DeleteWithContext(ctx, object); err != nil {
+			return err
+		}
+		log.Infof("%s deleted", object)
+		reason := reasonRoleDeleted
+		if strings.HasPrefix(object, "identity/") {
+			reason = reasonGroupDeleted
+		}
+		events.jobEventf(corev1.EventTypeNormal, reason, "Deleted %s", object)
+		delete(l.entries, object)
+	}
+	return l.save(ctx, clientsetK8s)
+}
+
+// applyJWTAuth enables a jwt or oidc auth method, writes its config, its
+// roles and its identity groups. It returns the Vault paths of the roles and
+// groups written.
+func applyJWTAuth(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, method jwtAuthSpec) ([]string, error) {
+	path := method.path()
+	if err := enableAuthMethod(ctx, client, authMethodSpec{
+		Path:        path,
+		Type:        method.authType(),
+		Description: method.Description,
+	}); err != nil {
+		return nil, err
+	}
+
+	config, err := jwtAuthConfig(method)
+	if err != nil {
+		return nil, err
+	}
+	if ref := method.OIDCClientSecret; ref != nil {
+		secret, err := clientsetK8s.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read OIDC client secret: %w", err)
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+		config["oidc_client_secret"] = string(value)
+	}
+	if _, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/config", config); err != nil {
+		return nil, err
+	}
+	log.Infof("%s auth %s/ configured", method.authType(), path)
+
+	var written []string
+	for _, role := range method.Roles {
+		if err := addJWTRole(ctx, client, path, role); err != nil {
+			return nil, err
+		}
+		written = append(written, fmt.Sprintf("auth/%s/role/%s", path, role.Name))
+	}
+
+	if len(method.Groups) == 0 {
+		return written, nil
+	}
+	auths, err := client.Sys().ListAuthWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mount, ok := auths[path+"/"]
+	if !ok {
+		return nil, fmt.Errorf("auth method %s/ not found", path)
+	}
+	for _, group := range method.Groups {
+		if err := ensureExternalGroup(ctx, client, group, mount.Accessor); err != nil {
+			return nil, fmt.Errorf("identity group %s: %w", group.Name, err)
+		}
+		written = append(written, "identity/group/name/"+group.Name)
+	}
+	return written, nil
+}
+
+// jwtAuthConfig returns the config of the method. Vault accepts exactly one
+// way to verify tokens: OIDC discovery, a JWKS URL or static public keys.
+func jwtAuthConfig(method jwtAuthSpec) (map[string]interface{}, error) {
+	sources := 0
+	config := map[string]interface{}{}
+	if method.OIDCDiscoveryURL != "" {
+		sources++
+		config["oidc_discovery_url"] = method.OIDCDiscoveryURL
+		if method.OIDCDiscoveryCAPEM != "" {
+			config["oidc_discovery_ca_pem"] = method.OIDCDiscoveryCAPEM
+		}
+	}
+	if method.JWKSURL != "" {
+		sources++
+		config["jwks_url"] = method.JWKSURL
+		if method.JWKSCAPEM != "" {
+			config["jwks_ca_pem"] = method.JWKSCAPEM
+		}
+	}
+	if len(method.JWTValidationPubkeys) > 0 {
+		sources++
+		config["jwt_validation_pubkeys"] = method.JWTValidationPubkeys
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("%s auth %s/: exactly one of oidcDiscoveryURL, jwksURL and jwtValidationPubkeys must be set", method.authType(), method.path())
+	}
+	if method.OIDCClientID != "" {
+		config["oidc_client_id"] = method.OIDCClientID
+	}
+	if method.authType() == "oidc" && (method.OIDCDiscoveryURL == "" || method.OIDCClientID == "") {
+		return nil, fmt.Errorf("oidc auth %s/: oidcDiscoveryURL and oidcClientID are required", method.path())
+	}
+	if method.BoundIssuer != "" {
+		config["bound_issuer"] = method.BoundIssuer
+	}
+	if method.DefaultRole != "" {
+		config["default_role"] = method.DefaultRole
+	}
+	return config, nil
+}
+
+func addJWTRole(ctx context.Context, client *vault.Client, authPath string, role jwtRoleSpec) error {
+	roleType := role.RoleType
+	if roleType == "" {
+		roleType = "jwt"
+	}
+	data := map[string]interface{}{
+		"role_type":      roleType,
+		"user_claim":     role.UserClaim,
+		"token_policies": role.Policies,
+	}
+	if len(role.BoundAudiences) > 0 {
+		data["bound_audiences"] = role.BoundAudiences
+	}
+	if role.BoundSubject != "" {
+		data["bound_subject"] = role.BoundSubject
+	}
+	if len(role.BoundClaims) > 0 {
+		data["bound_claims"] = role.BoundClaims
+	}
+	if role.BoundClaimsType != "" {
+		data["bound_claims_type"] = role.BoundClaimsType
+	}
+	if len(role.ClaimMappings) > 0 {
+		data["claim_mappings"] = role.ClaimMappings
+	}
+	if role.GroupsClaim != "" {
+		data["groups_claim"] = role.GroupsClaim
+	}
+	if len(role.AllowedRedirectURIs) > 0 {
+		data["allowed_redirect_uris"] = role.AllowedRedirectURIs
+	}
+	if len(role.OIDCScopes) > 0 {
+		data["oidc_scopes"] = role.OIDCScopes
+	}
+	if role.TTL != "" {
+		data["token_ttl"] = role.TTL
+	}
+	if role.MaxTTL != "" {
+		data["token_max_ttl"] = role.MaxTTL
+	}
+
+	path := fmt.Sprintf("auth/%s/role/%s", authPath, role.Name)
+	if _, err := client.Logical().WriteWithContext(ctx, path, data); err != nil {
+		return err
+	}
+	log.Infof("%s role '%s' configured", authPath, role.Name)
+	events.jobEventf(corev1.EventTypeNormal, reasonRoleWritten, "Wrote role %s on %s/", role.Name, authPath)
+	return nil
+}
@@ -0,0 +1,183 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestJWTAuthConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  jwtAuthSpec
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:   "oidc discovery",
+			method: jwtAuthSpec{OIDCDiscoveryURL: "https://gitlab.example.com", BoundIssuer: "https://gitlab.example.com"},
+			want: map[string]interface{}{
+				"oidc_discovery_url": "https://gitlab.example.com",
+				"bound_issuer":       "https://gitlab.example.com",
+			},
+		},
+		{
+			name:   "jwks url with ca",
+			method: jwtAuthSpec{JWKSURL: "https://ci.example.com/jwks", JWKSCAPEM: "ca", DefaultRole: "ci"},
+			want: map[string]interface{}{
+				"jwks_url":     "https://ci.example.com/jwks",
+				"jwks_ca_pem":  "ca",
+				"default_role": "ci",
+			},
+		},
+		{
+			name:   "static keys",
+			method: jwtAuthSpec{JWTValidationPubkeys: []string{"key"}},
+			want: map[string]interface{}{
+				"jwt_validation_pubkeys": []string{"key"},
+			},
+		},
+		{
+			name:    "no source",
+			method:  jwtAuthSpec{BoundIssuer: "https://gitlab.example.com"},
+			wantErr: "jwt auth jwt/: exactly one of",
+		},
+		{
+			name:    "two sources",
+			method:  jwtAuthSpec{Path: "ci", OIDCDiscoveryURL: "https://gitlab.example.com", JWKSURL: "https://gitlab.example.com/jwks"},
+			wantErr: "jwt auth ci/: exactly one of",
+		},
+		{
+			name:    "three sources",
+			method:  jwtAuthSpec{OIDCDiscoveryURL: "https://a", JWKSURL: "https://b", JWTValidationPubkeys: []string{"key"}},
+			wantErr: "exactly one of",
+		},
+		{
+			name: "oidc",
+			method: jwtAuthSpec{
+				Type:             "oidc",
+				OIDCDiscoveryURL: "https://sso.example.com",
+				OIDCClientID:     "vault",
+			},
+			want: map[string]interface{}{
+				"oidc_discovery_url": "https://sso.example.com",
+				"oidc_client_id":     "vault",
+			},
+		},
+		{
+			name:    "oidc without client id",
+			method:  jwtAuthSpec{Type: "oidc", OIDCDiscoveryURL: "https://sso.example.com"},
+			wantErr: "oidc auth oidc/: oidcDiscoveryURL and oidcClientID are required",
+		},
+		{
+			name:    "oidc with jwks url",
+			method:  jwtAuthSpec{Type: "oidc", JWKSURL: "https://sso.example.com/jwks", OIDCClientID: "vault"},
+			wantErr: "oidcDiscoveryURL and oidcClientID are required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jwtAuthConfig(tt.method)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("config = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConfigureJWTAuthJWKS writes a jwt auth method verifying tokens with
+// the keys of a JWKS server. Like Vault, the fake fetches the keys from the
+// written jwks_url.
+func TestConfigureJWTAuthJWKS(t *testing.T) {
+	var jwksRequests atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwksRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"RSA","kid":"ci","use":"sig","alg":"RS256","n":"sXch","e":"AQAB"}]}`))
+	}))
+	t.Cleanup(jwks.Close)
+
+	var config map[string]interface{}
+	var roles []string
+	vaultServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/sys/auth" && r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data":{}}`))
+		case r.URL.Path == "/v1/sys/auth/ci":
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/v1/auth/ci/config":
+			if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+				t.Error(err)
+			}
+			jwksURL, _ := config["jwks_url"].(string)
+			resp, err := http.Get(jwksURL)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			resp.Body.Close()
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasPrefix(r.URL.Path, "/v1/auth/ci/role/"):
+			roles = append(roles, strings.TrimPrefix(r.URL.Path, "/v1/auth/ci/role/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(vaultServer.Close)
+
+	vaultConfig := vault.DefaultConfig()
+	vaultConfig.Address = vaultServer.URL
+	client, err := vault.NewClient(vaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("root")
+
+	method := jwtAuthSpec{
+		Path:        "ci",
+		JWKSURL:     jwks.URL,
+		BoundIssuer: "https://ci.example.com",
+		Roles: []jwtRoleSpec{{
+			Name:           "deploy",
+			UserClaim:      "sub",
+			BoundAudiences: []string{"vault"},
+			Policies:       []string{"deploy"},
+		}},
+	}
+	if err := configureJWTAuth(context.Background(), client, k8sfake.NewSimpleClientset(), []jwtAuthSpec{method}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := config["jwks_url"]; got != jwks.URL {
+		t.Errorf("jwks_url = %v, want %s", got, jwks.URL)
+	}
+	if _, ok := config["oidc_discovery_url"]; ok {
+		t.Error("oidc_discovery_url written along with jwks_url")
+	}
+	if jwksRequests.Load() == 0 {
+		t.Error("JWKS not fetched from the written jwks_url")
+	}
+	if !reflect.DeepEqual(roles, []string{"deploy"}) {
+		t.Errorf("roles = %v, want [deploy]", roles)
+	}
+}
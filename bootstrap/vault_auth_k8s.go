@@ -1,76 +1,245 @@
 package bootstrap
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"os"
-	"time"
+	"strings"
 
 	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-func checkVaultUp(client *vault.Client) bool {
-	for i := 0; i < 15; i++ {
-		hr, err := client.Sys().Health()
+// reviewerJWTLedgerKey records the SHA-256 of the token_reviewer_jwt last
+// written to every kubernetes auth path
+const reviewerJWTLedgerKey = "reviewer-jwts.json"
+
+func checkVaultUp(ctx context.Context, client *vault.Client) error {
+	return retry(ctx, "k8s auth: wait for Vault", func(ctx context.Context) (bool, error) {
+		hr, err := client.Sys().HealthWithContext(ctx)
 		if err != nil {
 			log.Warn(err.Error(), "k8s auth: Retrying...")
-			time.Sleep(1 * time.Second)
-			continue
+			return false, err
 		}
 		if !hr.Initialized || hr.Sealed {
 			log.Warn("k8s auth: Vault not Initialized/Unsealed. Retrying...")
-			time.Sleep(1 * time.Second)
-			continue
+			return false, nil
 		}
-		return true
-	}
-	return false
+		return true, nil
+	})
 }
 
-func checkK8sAuth(client *vault.Client) (bool, error) {
-	auths, err := client.Logical().Read("sys/auth")
+func checkK8sAuth(ctx context.Context, client *vault.Client) (bool, error) {
+	auths, err := client.Logical().ReadWithContext(ctx, "sys/auth")
 	if err != nil {
 		return false, err
 	}
-	if k8sAuth := auths.Data["kubernetes/"]; k8sAuth != nil {
+	if k8sAuth := auths.Data[vaultK8sAuthPath+"/"]; k8sAuth != nil {
 		log.Info("k8s auth already enabled")
+		runReport.addStep(reasonAuthEnabled, vaultK8sAuthPath+"/", stepSkipped, "already enabled")
 		return true, nil
 	}
 	return false, nil
 }
 
-func configureK8sAuth(client *vault.Client, clientsetK8s *kubernetes.Clientset) error {
-	err := client.Sys().EnableAuthWithOptions("kubernetes/", &vault.EnableAuthOptions{
+func enableK8sAuth(ctx context.Context, client *vault.Client) error {
+	err := client.Sys().EnableAuthWithOptionsWithContext(ctx, vaultK8sAuthPath+"/", &vault.EnableAuthOptions{
 		Type: "kubernetes",
 	})
+	if err != nil {
+		return err
+	}
+	log.Info("k8s auth: Successfully enabled")
+	events.jobEventf(corev1.EventTypeNormal, reasonAuthEnabled, "Enabled auth method %s/", vaultK8sAuthPath)
+	return nil
+}
+
+// k8sAuthConfig returns the desired auth/<path>/config. Optional settings
+// are only included when they are set.
+func k8sAuthConfig() (map[string]interface{}, error) {
+	k8sHost := vaultK8sAuthKubernetesHost
+	if k8sHost == "" {
+		// Get k8s API URL
+		const (
+			EnvK8sSvc  = "KUBERNETES_SERVICE_HOST"
+			EnvK8sPort = "KUBERNETES_SERVICE_PORT"
+		)
+		k8sSvc, ok := os.LookupEnv(EnvK8sSvc)
+		if !ok {
+			return nil, fmt.Errorf("k8s auth: lookup of %s failed", EnvK8sSvc)
+		}
+		k8sPort, ok := os.LookupEnv(EnvK8sPort)
+		if !ok {
+			return nil, fmt.Errorf("k8s auth: lookup of %s failed", EnvK8sPort)
+		}
+		k8sHost = fmt.Sprintf("https://%s:%s", k8sSvc, k8sPort)
+	}
 
+	config := map[string]interface{}{
+		"kubernetes_host": k8sHost,
+	}
+	if vaultK8sAuthCACert != "" {
+		config["kubernetes_ca_cert"] = vaultK8sAuthCACert
+	}
+	if vaultK8sAuthTokenReviewerJWT != "" {
+		config["token_reviewer_jwt"] = vaultK8sAuthTokenReviewerJWT
+	}
+	if len(vaultK8sAuthPEMKeys) > 0 {
+		config["pem_keys"] = vaultK8sAuthPEMKeys
+	}
+	if vaultK8sAuthIssuer != "" {
+		config["issuer"] = vaultK8sAuthIssuer
+	}
+	if vaultK8sAuthDisableIssValidation != nil {
+		config["disable_iss_validation"] = *vaultK8sAuthDisableIssValidation
+	}
+	if vaultK8sAuthDisableLocalCAJWT != nil {
+		config["disable_local_ca_jwt"] = *vaultK8sAuthDisableLocalCAJWT
+	}
+	return config, nil
+}
+
+// configureK8sAuth writes the k8s auth config when it differs from the one
+// stored in Vault
+func configureK8sAuth(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface) error {
+	desired, err := k8sAuthConfig()
 	if err != nil {
 		return err
 	}
+	rotated := false
+	if vaultK8sAuthReviewer {
+		jwt, newToken, err := ensureTokenReviewer(ctx, clientsetK8s)
+		if err != nil {
+			return fmt.Errorf("k8s auth: cannot provision token reviewer: %w", err)
+		}
+		desired["token_reviewer_jwt"] = jwt
+		rotated = newToken
+	}
+	return writeK8sAuthConfig(ctx, client, clientsetK8s, vaultK8sAuthPath, desired, rotated)
+}
 
-	// Get k8s API URL
-	const (
-		EnvK8sSvc  = "KUBERNETES_SERVICE_HOST"
-		EnvK8sPort = "KUBERNETES_SERVICE_PORT"
-	)
-	k8sSvc, ok := os.LookupEnv(EnvK8sSvc)
-	if !ok {
-		return fmt.Errorf("k8s auth: lookup of %s failed", EnvK8sSvc)
+// writeK8sAuthConfig writes the config of the kubernetes auth method mounted
+// at path unless Vault already has it. Vault never returns the reviewer JWT,
+// so a change of it is detected by the hash in the ledger. force writes the
+// config anyway.
+func writeK8sAuthConfig(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, path string, desired map[string]interface{}, force bool) error {
+	configPath := fmt.Sprintf("auth/%s/config", path)
+	current, err := client.Logical().ReadWithContext(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	l, err := loadLedger(ctx, clientsetK8s, reviewerJWTLedgerKey)
+	if err != nil {
+		return err
+	}
+	jwtHash := reviewerJWTHash(desired)
+	if l.entries[path] != jwtHash {
+		log.Debugf("k8s auth: %s token_reviewer_jwt changed", path)
+		force = true
 	}
-	k8sPort, ok := os.LookupEnv(EnvK8sPort)
-	if !ok {
-		return fmt.Errorf("k8s auth: lookup of %s failed", EnvK8sPort)
+	if !force && current != nil && !k8sAuthConfigDrifted(current.Data, desired) {
+		log.Infof("k8s auth: %s config up to date", path)
+		return nil
 	}
-	k8sHost := fmt.Sprintf("https://%s:%s", k8sSvc, k8sPort)
 
 	// Configure k8s authentication
-	_, err = client.Logical().Write("auth/kubernetes/config", map[string]interface{}{
-		"kubernetes_host": k8sHost,
-	})
+	_, err = client.Logical().WriteWithContext(ctx, configPath, desired)
 	if err != nil {
 		return err
 	}
-	log.Info("k8s auth: Successfully enabled")
-	return nil
+	log.Infof("k8s auth: %s config written", path)
+	events.jobEventf(corev1.EventTypeNormal, reasonAuthEnabled, "Configured auth method %s/", path)
+
+	if l.entries[path] == jwtHash {
+		return nil
+	}
+	if jwtHash == "" {
+		delete(l.entries, path)
+	} else {
+		l.entries[path] = jwtHash
+	}
+	return l.save(ctx, clientsetK8s)
+}
+
+// reviewerJWTHash returns the hex SHA-256 of the token_reviewer_jwt of the
+// config, empty without one
+func reviewerJWTHash(config map[string]interface{}) string {
+	jwt, _ := config["token_reviewer_jwt"].(string)
+	if jwt == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(jwt))
+	return hex.EncodeToString(sum[:])
+}
+
+// k8sAuthConfigDrifted compares the config read from Vault with the desired
+// one. The token reviewer JWT is never returned by Vault, so only whether it
+// is set is compared; writeK8sAuthConfig detects changes of its value.
+func k8sAuthConfigDrifted(current map[string]interface{}, desired map[string]interface{}) bool {
+	for key, want := range desired {
+		if key == "token_reviewer_jwt" {
+			if set, _ := current["token_reviewer_jwt_set"].(bool); !set {
+				return true
+			}
+			continue
+		}
+		if fmt.Sprint(normalizeConfigValue(current[key])) != fmt.Sprint(normalizeConfigValue(want)) {
+			log.Debugf("k8s auth: %s drifted", key)
+			return true
+		}
+	}
+	// Settings that were removed from the desired config
+	for _, key := range []string{"kubernetes_ca_cert", "issuer", "pem_keys"} {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if v := normalizeConfigValue(current[key]); v != "" && fmt.Sprint(v) != "[]" {
+			log.Debugf("k8s auth: %s drifted", key)
+			return true
+		}
+	}
+	if _, ok := desired["token_reviewer_jwt"]; !ok {
+		if set, _ := current["token_reviewer_jwt_set"].(bool); set {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeConfigValue turns the values decoded from Vault JSON and the
+// desired Go values into comparable ones
+func normalizeConfigValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, item := range v {
+			s = append(s, strings.TrimSpace(fmt.Sprint(item)))
+		}
+		return s
+	case string:
+		return strings.TrimSpace(v)
+	}
+	return v
+}
+
+// splitPEMBlocks splits concatenated PEM encoded keys into separate ones
+func splitPEMBlocks(data string) []string {
+	var blocks []string
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, strings.TrimSpace(string(pem.EncodeToMemory(block))))
+	}
+	return blocks
 }
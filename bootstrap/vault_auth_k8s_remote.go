@@ -0,0 +1,152 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Keys of a remote cluster secret
+const (
+	clusterSecretKubeconfig = "kubeconfig"
+	clusterSecretHost       = "host"
+	clusterSecretCACert     = "ca.crt"
+	clusterSecretToken      = "token"
+)
+
+// authPath returns the mount path of the kubernetes auth method of the
+// cluster, kubernetes-<name> unless set
+func (c clusterSpec) authPath() string {
+	if c.Path != "" {
+		return strings.Trim(c.Path, "/")
+	}
+	return "kubernetes-" + c.Name
+}
+
+// configureRemoteCluster enables and configures the kubernetes auth mount of
+// a remote cluster and writes its roles
+func configureRemoteCluster(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, cluster clusterSpec) error {
+	path := cluster.authPath()
+	config, err := remoteClusterConfig(ctx, clientsetK8s, cluster)
+	if err != nil {
+		return err
+	}
+
+	auths, err := client.Sys().ListAuthWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if mount, ok := auths[path+"/"]; ok {
+		if mount.Type != "kubernetes" {
+			return fmt.Errorf("auth method %s/ has type %s, expected kubernetes", path, mount.Type)
+		}
+		log.Infof("k8s auth %s/ already enabled", path)
+		runReport.addStep(reasonAuthEnabled, path+"/", stepSkipped, "already enabled")
+	} else {
+		err := client.Sys().EnableAuthWithOptionsWithContext(ctx, path+"/", &vault.EnableAuthOptions{
+			Type:        "kubernetes",
+			Description: "Kubernetes cluster " + cluster.Name,
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("k8s auth %s/: Successfully enabled", path)
+		events.jobEventf(corev1.EventTypeNormal, reasonAuthEnabled, "Enabled auth method %s/", path)
+	}
+
+	if err := writeK8sAuthConfig(ctx, client, clientsetK8s, path, config, false); err != nil {
+		return err
+	}
+
+	for _, role := range cluster.Roles {
+		if err := addRole(ctx, client, path, &role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteClusterConfig builds the auth config of a remote cluster from its
+// secret. The local CA and service account JWT belong to this cluster, so
+// they are never used for a remote one.
+func remoteClusterConfig(ctx context.Context, clientsetK8s kubernetes.Interface, cluster clusterSpec) (map[string]interface{}, error) {
+	secret, err := clientsetK8s.CoreV1().Secrets(namespace).Get(ctx, cluster.Secret, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var host, caCert, token string
+	if kubeconfig, ok := secret.Data[clusterSecretKubeconfig]; ok {
+		host, caCert, token, err = kubeconfigCredentials(kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig of secret %s: %w", cluster.Secret, err)
+		}
+	} else {
+		host = string(secret.Data[clusterSecretHost])
+		caCert = string(secret.Data[clusterSecretCACert])
+		token = string(secret.Data[clusterSecretToken])
+	}
+	if host == "" {
+		return nil, fmt.Errorf("secret %s has neither %s nor %s", cluster.Secret, clusterSecretKubeconfig, clusterSecretHost)
+	}
+
+	config := map[string]interface{}{
+		"kubernetes_host":      host,
+		"disable_local_ca_jwt": true,
+	}
+	if caCert != "" {
+		config["kubernetes_ca_cert"] = caCert
+	}
+	if token != "" {
+		config["token_reviewer_jwt"] = token
+	} else {
+		log.Warnf("k8s auth %s: no reviewer token, clients' own JWTs are used for TokenReview", cluster.authPath())
+	}
+	return config, nil
+}
+
+// kubeconfigCredentials returns the server, CA and token of the current
+// context of a kubeconfig. The kubeconfig comes from a Secret, so references
+// to files and exec or auth provider plugins are refused: they would be
+// resolved on the filesystem of the tool. The CA and the token must be inline.
+func kubeconfigCredentials(data []byte) (host, caCert, token string, err error) {
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return "", "", "", err
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return "", "", "", fmt.Errorf("current context %q not found", kubeconfig.CurrentContext)
+	}
+	cluster, ok := kubeconfig.Clusters[kubeContext.Cluster]
+	if !ok {
+		return "", "", "", fmt.Errorf("cluster %q not found", kubeContext.Cluster)
+	}
+	authInfo, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return "", "", "", fmt.Errorf("user %q not found", kubeContext.AuthInfo)
+	}
+
+	switch {
+	case cluster.CertificateAuthority != "":
+		return "", "", "", fmt.Errorf("certificate-authority files are not supported, use certificate-authority-data")
+	case authInfo.TokenFile != "":
+		return "", "", "", fmt.Errorf("tokenFile is not supported, use token")
+	case authInfo.Exec != nil, authInfo.AuthProvider != nil:
+		return "", "", "", fmt.Errorf("exec and auth-provider credentials are not supported, use token")
+	case authInfo.ClientCertificate != "", authInfo.ClientKey != "":
+		return "", "", "", fmt.Errorf("client certificate files are not supported")
+	case len(cluster.CertificateAuthorityData) == 0:
+		return "", "", "", fmt.Errorf("certificate-authority-data is required")
+	case authInfo.Token == "":
+		return "", "", "", fmt.Errorf("token is required")
+	}
+	return cluster.Server, string(cluster.CertificateAuthorityData), authInfo.Token, nil
+}
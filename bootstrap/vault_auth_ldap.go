@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const ldapGroupsLedgerKey = "ldap-groups.json"
+
+// path returns the mount path of the method, ldap/ unless set
+func (m ldapAuthSpec) path() string {
+	if m.Path != "" {
+		return strings.Trim(m.Path, "/")
+	}
+	return "ldap"
+}
+
+// configureLDAPAuth enables the ldap auth methods, writes their config and
+// group mappings and deletes the mappings the tool created that are no
+// longer declared
+func configureLDAPAuth(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, methods []ldapAuthSpec) error {
+	l, err := loadLedger(ctx, clientsetK8s, ldapGroupsLedgerKey)
+	if err != nil {
+		return err
+	}
+	if len(methods) == 0 && len(l.entries) == 0 {
+		return nil
+	}
+
+	declared := map[string]bool{}
+	for _, method := range methods {
+		path := method.path()
+		if err := enableAuthMethod(ctx, client, authMethodSpec{
+			Path:        path,
+			Type:        "ldap",
+			Description: method.Description,
+		}); err != nil {
+			return err
+		}
+		config, err := ldapAuthConfig(ctx, clientsetK8s, method)
+		if err != nil {
+			return fmt.Errorf("ldap auth %s/: %w", path, err)
+		}
+		if _, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/config", config); err != nil {
+			return err
+		}
+		log.Infof("ldap auth %s/ configured", path)
+
+		for _, group := range method.Groups {
+			groupPath := fmt.Sprintf("auth/%s/groups/%s", path, group.Name)
+			if _, err := client.Logical().WriteWithContext(ctx, groupPath, map[string]interface{}{
+				"policies": group.Policies,
+			}); err != nil {
+				return err
+			}
+			log.Infof("ldap group '%s' configured on %s", group.Name, path)
+			events.jobEventf(corev1.EventTypeNormal, reasonGroupWritten, "Wrote ldap group %s on %s/", group.Name, path)
+			key := path + "/" + group.Name
+			declared[key] = true
+			l.entries[key] = path
+		}
+	}
+
+	var removed []string
+	for key := range l.entries {
+		if !declared[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		if _, err := client.Logical().DeleteWithContext(ctx, "auth/"+l.entries[key]+"/groups/"+strings.TrimPrefix(key, l.entries[key]+"/")); err != nil {
+			return err
+		}
+		log.Infof("ldap group %s deleted", key)
+		events.jobEventf(corev1.EventTypeNormal, reasonGroupDeleted, "Deleted ldap group %s", key)
+		delete(l.entries, key)
+	}
+	return l.save(ctx, clientsetK8s)
+}
+
+// ldapAuthConfig returns the config of the method with the bind password
+// read from its K8s secret
+func ldapAuthConfig(ctx context.Context, clientsetK8s kubernetes.Interface, method ldapAuthSpec) (map[string]interface{}, error) {
+	if method.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	config := map[string]interface{}{
+		"url":      method.URL,
+		"starttls": method.StartTLS,
+	}
+	optional := map[string]string{
+		"binddn":      method.BindDN,
+		"userdn":      method.UserDN,
+		"userattr":    method.UserAttr,
+		"groupdn":     method.GroupDN,
+		"groupfilter": method.GroupFilter,
+		"groupattr":   method.GroupAttr,
+		"certificate": method.Certificate,
+		"upndomain":   method.UPNDomain,
+	}
+	for key, value := range optional {
+		if value != "" {
+			config[key] = value
+		}
+	}
+	if ref := method.BindPass; ref != nil && clientsetK8s != nil {
+		secret, err := clientsetK8s.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read bind password: %w", err)
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+		config["bindpass"] = string(value)
+	}
+	return config, nil
+}
@@ -0,0 +1,72 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of a kubernetes.io/tls secret holding the Vault TLS material
+const (
+	tlsSecretCAKey   = "ca.crt"
+	tlsSecretCertKey = "tls.crt"
+	tlsSecretKeyKey  = "tls.key"
+)
+
+// vaultClientCertificate is the client certificate loaded from
+// VAULT_TLS_SECRET. It takes precedence over VAULT_CLIENT_CERT/KEY.
+var vaultClientCertificate *tls.Certificate
+
+// loadVaultTLSFromSecret reads the CA bundle and client certificate from the
+// K8s secret named by VAULT_TLS_SECRET, if set
+func loadVaultTLSFromSecret(ctx context.Context, clientsetK8s kubernetes.Interface) error {
+	if vaultTLSSecret == "" {
+		return nil
+	}
+	secret, err := clientsetK8s.CoreV1().Secrets(namespace).Get(ctx, vaultTLSSecret, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("tls: cannot read secret %s: %w", vaultTLSSecret, err)
+	}
+	if ca, ok := secret.Data[tlsSecretCAKey]; ok {
+		vaultTLS.CACert = ""
+		vaultTLS.CAPath = ""
+		vaultTLS.CACertBytes = ca
+	}
+	cert, hasCert := secret.Data[tlsSecretCertKey]
+	key, hasKey := secret.Data[tlsSecretKeyKey]
+	if hasCert && hasKey {
+		certificate, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return fmt.Errorf("tls: invalid client certificate in secret %s: %w", vaultTLSSecret, err)
+		}
+		vaultClientCertificate = &certificate
+	}
+	log.Debugf("tls: loaded TLS material from secret %s", vaultTLSSecret)
+	return nil
+}
+
+// newVaultClient returns a client for addr that verifies the server with the
+// configured CA bundle and presents the configured client certificate
+func newVaultClient(addr string) (*vault.Client, error) {
+	clientConfig := vault.DefaultConfig()
+	if clientConfig.Error != nil {
+		return nil, clientConfig.Error
+	}
+	clientConfig.Address = addr
+	if err := clientConfig.ConfigureTLS(&vaultTLS); err != nil {
+		return nil, err
+	}
+	if vaultClientCertificate != nil {
+		transport := clientConfig.HttpClient.Transport.(*http.Transport)
+		transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return vaultClientCertificate, nil
+		}
+	}
+	return vault.NewClient(clientConfig)
+}
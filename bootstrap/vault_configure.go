@@ -0,0 +1,140 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// configureVault applies the policies of the spec, enables the kubernetes
+// auth method and applies the auth methods, roles, remote clusters and
+// secret engines of the spec.
+// The client must carry a root token.
+func configureVault(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, spec bootstrapSpec) error {
+	// Refuse an invalid spec before anything is changed
+	existingPolicies, err := client.Sys().ListPoliciesWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	findings := validateSpec(spec, existingPolicies)
+	for _, w := range findings.warnings {
+		log.Warn(w)
+	}
+	if err := findings.err(); err != nil {
+		for _, e := range findings.errors {
+			log.Error(e)
+		}
+		return err
+	}
+
+	// Policies come first, so no auth method or role is usable before the
+	// policies it refers to exist. Templates referring to an auth method
+	// this run enables are written as soon as it is enabled.
+	pending, err := writePolicies(ctx, client, spec.Policies)
+	if err != nil {
+		return err
+	}
+
+	// enable k8s auth
+	k8sAuth, err := checkK8sAuth(ctx, client)
+	if err != nil {
+		return err
+	}
+	if !k8sAuth {
+		if err := enableK8sAuth(ctx, client); err != nil {
+			return err
+		}
+	}
+	// Re-applied on every run to correct drift
+	if err := configureK8sAuth(ctx, client, clientsetK8s); err != nil {
+		return err
+	}
+
+	for _, method := range spec.AuthMethods {
+		if err := enableAuthMethod(ctx, client, method); err != nil {
+			return err
+		}
+	}
+	if pending, err = writePolicies(ctx, client, pending); err != nil {
+		return err
+	}
+
+	// Also runs without jwt methods to prune the roles and groups of removed
+	// ones
+	if err := configureJWTAuth(ctx, client, clientsetK8s, spec.JWTAuth); err != nil {
+		return err
+	}
+	if pending, err = writePolicies(ctx, client, pending); err != nil {
+		return err
+	}
+
+	// Also runs without ldap methods to prune the groups of removed ones
+	if err := configureLDAPAuth(ctx, client, clientsetK8s, spec.LDAPAuth); err != nil {
+		return err
+	}
+	if pending, err = writePolicies(ctx, client, pending); err != nil {
+		return err
+	}
+
+	// add roles
+	for _, role := range spec.Roles {
+		if err := addRole(ctx, client, vaultK8sAuthPath, &role); err != nil {
+			return err
+		}
+	}
+
+	// remote clusters
+	for _, cluster := range spec.Clusters {
+		if err := configureRemoteCluster(ctx, client, clientsetK8s, cluster); err != nil {
+			return fmt.Errorf("cluster %s: %w", cluster.Name, err)
+		}
+	}
+	// Every auth method is enabled now, so a still pending template fails
+	for _, policy := range pending {
+		if err := addPolicy(ctx, client, policy); err != nil {
+			return err
+		}
+	}
+
+	if len(spec.AppRoles) > 0 {
+		if err := configureAppRoles(ctx, client, clientsetK8s, spec.AppRoles); err != nil {
+			return err
+		}
+	}
+
+	// enable secret engines
+	for _, mount := range spec.Mounts {
+		secret, err := checkSecretEngine(ctx, client, mount.path())
+		if err != nil {
+			return err
+		}
+		if !secret {
+			if err := enableSecretEngine(ctx, client, mount); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writePolicies writes the policies and returns those whose template refers
+// to an auth method that is not enabled yet
+func writePolicies(ctx context.Context, client *vault.Client, policies []policySpec) ([]policySpec, error) {
+	var pending []policySpec
+	for _, policy := range policies {
+		err := addPolicy(ctx, client, policy)
+		if errors.Is(err, errAuthNotEnabled) {
+			log.Debugf("%s, writing it later", err.Error())
+			pending = append(pending, policy)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,93 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type memberResult struct {
+	name     string
+	joined   bool
+	unsealed bool
+	err      error
+}
+
+// joinAndUnsealFollowers joins every follower to the leader's raft cluster
+// and unseals it. Followers that preflight reported as initialized are
+// already part of the cluster and are only unsealed. Up to
+// vaultUnsealConcurrency followers are processed at the same time; errors
+// from all of them are returned together.
+func joinAndUnsealFollowers(ctx context.Context, leader vaultPod, followers []vaultPod, statuses map[string]nodeStatus, unsealKeys []string) error {
+	workers := vaultUnsealConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]memberResult, len(followers))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, pod := range followers {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = memberResult{name: pod.name, err: fmt.Errorf("%s: %w", pod.name, ctx.Err())}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, pod vaultPod) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = joinAndUnsealMember(ctx, pod, leader, statuses[pod.name], unsealKeys)
+		}(i, pod)
+	}
+	wg.Wait()
+
+	logMemberResults(results)
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func joinAndUnsealMember(ctx context.Context, pod vaultPod, leader vaultPod, status nodeStatus, unsealKeys []string) memberResult {
+	result := memberResult{name: pod.name}
+	if status.initialized {
+		log.Debugf("%s: already initialized, skipping raft join", pod.name)
+		runReport.addStep(reasonRaftJoined, pod.name, stepSkipped, "already initialized")
+	} else if err := operatorRaftJoin(ctx, pod, leader); err != nil {
+		result.err = fmt.Errorf("%s: raft join: %w", pod.name, err)
+		return result
+	}
+	result.joined = true
+	if _, err := unsealMember(ctx, pod, unsealKeys); err != nil {
+		result.err = err
+		return result
+	}
+	result.unsealed = true
+	return result
+}
+
+func logMemberResults(results []memberResult) {
+	var succeeded, failed []string
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r.name)
+			continue
+		}
+		succeeded = append(succeeded, r.name)
+	}
+	log.Infof("Followers joined and unsealed: %d/%d", len(succeeded), len(results))
+	if len(succeeded) > 0 {
+		log.Infof("Succeeded: %s", strings.Join(succeeded, ", "))
+	}
+	if len(failed) > 0 {
+		log.Errorf("Failed: %s", strings.Join(failed, ", "))
+	}
+}
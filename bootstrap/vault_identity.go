@@ -0,0 +1,57 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ensureExternalGroup writes an external identity group with its policies
+// and links it to the group named alias of the auth method with the given
+// accessor, e.g. a value of the OIDC groups claim
+func ensureExternalGroup(ctx context.Context, client *vault.Client, group identityGroupSpec, accessor string) error {
+	groupPath := "identity/group/name/" + group.Name
+	if _, err := client.Logical().WriteWithContext(ctx, groupPath, map[string]interface{}{
+		"type":     "external",
+		"policies": group.Policies,
+	}); err != nil {
+		return err
+	}
+	existing, err := client.Logical().ReadWithContext(ctx, groupPath)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("identity group %s not found after writing it", group.Name)
+	}
+	groupID, _ := existing.Data["id"].(string)
+	log.Infof("identity group '%s' configured", group.Name)
+
+	aliasName := group.Alias
+	if aliasName == "" {
+		aliasName = group.Name
+	}
+	alias := map[string]interface{}{
+		"name":           aliasName,
+		"mount_accessor": accessor,
+		"canonical_id":   groupID,
+	}
+	aliasPath := "identity/group-alias"
+	// An external group has at most one alias, update it in place
+	if current, ok := existing.Data["alias"].(map[string]interface{}); ok && current["id"] != nil && current["id"] != "" {
+		if current["name"] == aliasName && current["mount_accessor"] == accessor {
+			log.Infof("identity group alias '%s' up to date", aliasName)
+			return nil
+		}
+		aliasPath = fmt.Sprintf("identity/group-alias/id/%s", current["id"])
+	}
+	if _, err := client.Logical().WriteWithContext(ctx, aliasPath, alias); err != nil {
+		return err
+	}
+	log.Infof("identity group alias '%s' linked to group '%s'", aliasName, group.Name)
+	events.jobEventf(corev1.EventTypeNormal, reasonGroupWritten, "Linked group alias %s to identity group %s", aliasName, group.Name)
+	return nil
+}
@@ -1,63 +1,64 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 )
 
-func checkInit(pod vaultPod) (bool, error) {
-	init, err := pod.client.Sys().InitStatus()
+func checkInit(ctx context.Context, pod vaultPod) (bool, error) {
+	init, err := pod.client.Sys().InitStatusWithContext(ctx)
 	if err != nil {
 		return false, err
 	}
 	return init, nil
 }
 
-func operatorInit(pod vaultPod) (*string, *[]string, error) {
+func operatorInit(ctx context.Context, pod vaultPod, keyShares int, keyThreshold int) (*string, *[]string, error) {
 	initReq := &vault.InitRequest{
-		SecretShares:    vaultKeyShares,
-		SecretThreshold: vaultKeyThreshold,
+		SecretShares:    keyShares,
+		SecretThreshold: keyThreshold,
 	}
-	initResp, err := pod.client.Sys().Init(initReq)
+	initResp, err := pod.client.Sys().InitWithContext(ctx, initReq)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	for i := 0; i < 15; i++ {
-		init, err := checkInit(pod)
+	err = retry(ctx, pod.name+": wait for init", func(ctx context.Context) (bool, error) {
+		init, err := checkInit(ctx, pod)
 		if err != nil {
-			log.Errorf(err.Error())
-			time.Sleep(1 * time.Second)
-			continue
+			return false, err
 		}
-		if !init {
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		log.Infof("%s: vault successfully initialized", pod.name)
-		return &initResp.RootToken, &initResp.Keys, nil
+		return init, nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot proceed, vault not initialized: %w", err)
 	}
-	panic("Cannot proceed. Vault not initialized")
+	log.Infof("%s: vault successfully initialized", pod.name)
+	events.podEventf(pod.name, corev1.EventTypeNormal, reasonInitialized, "Vault initialized with %d key shares and threshold %d", keyShares, keyThreshold)
+	return &initResp.RootToken, &initResp.Keys, nil
 }
 
-func operatorRaftJoin(pod vaultPod, leader vaultPod) error {
+func operatorRaftJoin(ctx context.Context, pod vaultPod, leader vaultPod) error {
 	log.Debugf("%s: raft join", pod.name)
 	joinReq := &vault.RaftJoinRequest{
 		LeaderAPIAddr: leader.fqdn,
 	}
-	joinResp, err := pod.client.Sys().RaftJoin(joinReq)
+	joinResp, err := pod.client.Sys().RaftJoinWithContext(ctx, joinReq)
+	if err == nil && (joinResp == nil || !joinResp.Joined) {
+		err = fmt.Errorf("nil or negative response from raft join request: %v", joinResp)
+	}
 	if err != nil {
+		events.podEventf(pod.name, corev1.EventTypeWarning, reasonRaftJoinFailed, "Raft join to %s failed: %s", leader.name, err.Error())
 		return err
 	}
-	if joinResp == nil || !joinResp.Joined {
-		return fmt.Errorf("nil or negative response from raft join request: %v", joinResp)
-	}
 
 	log.Infof("%s: node successfully joined raft", pod.name)
+	events.podEventf(pod.name, corev1.EventTypeNormal, reasonRaftJoined, "Joined raft cluster of %s", leader.name)
 	return nil
 }
 
@@ -0,0 +1,78 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// unsealKeyCache keeps the unseal keys of the long-running modes between
+// reconciles, so the K8s secret is only read when they are not cached
+type unsealKeyCache struct {
+	clientsetK8s kubernetes.Interface
+
+	mu   sync.Mutex
+	keys []string
+}
+
+// load returns the unseal keys, reading them from the K8s secret only when
+// they are not cached yet
+func (c *unsealKeyCache) load(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		keys, err := loadUnsealKeys(ctx, c.clientsetK8s)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = keys
+	}
+	return c.keys, nil
+}
+
+// reset drops the cached keys after a failed reconcile. They may have been
+// rotated, so they are read again next time.
+func (c *unsealKeyCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = nil
+}
+
+// ensureMemberUnsealed brings a single member back into the cluster: a
+// member that is not initialized is joined to the leader once the leader is
+// unsealed, and a sealed member is unsealed with the keys returned by
+// unsealKeys. The leader itself is never joined, it is initialized by the
+// bootstrap job. It returns the member status as found before any action.
+func ensureMemberUnsealed(ctx context.Context, pod vaultPod, leader vaultPod, unsealKeys func(context.Context) ([]string, error)) (nodeStatus, error) {
+	status, err := getNodeStatus(ctx, pod)
+	if err != nil {
+		return status, fmt.Errorf("%s: %w", pod.name, err)
+	}
+	if status.initialized && !status.sealed {
+		return status, nil
+	}
+
+	if !status.initialized {
+		if pod.name == leader.name {
+			return status, fmt.Errorf("%s: not initialized yet, waiting for the bootstrap job", pod.name)
+		}
+		leaderStatus, err := getNodeStatus(ctx, leader)
+		if err != nil || !leaderStatus.initialized || leaderStatus.sealed {
+			return status, fmt.Errorf("%s: waiting for %s to be initialized and unsealed", pod.name, leader.name)
+		}
+		if err := operatorRaftJoin(ctx, pod, leader); err != nil {
+			return status, fmt.Errorf("%s: raft join: %w", pod.name, err)
+		}
+	}
+
+	keys, err := unsealKeys(ctx)
+	if err != nil {
+		return status, fmt.Errorf("%s: cannot load unseal keys: %w", pod.name, err)
+	}
+	if _, err := unsealMember(ctx, pod, keys); err != nil {
+		return status, err
+	}
+	return status, nil
+}
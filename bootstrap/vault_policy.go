@@ -1,8 +1,12 @@
 package bootstrap
 
 import (
+	"context"
+	"fmt"
+
 	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 )
 
 const policyName = "read-all"
@@ -12,11 +16,34 @@ path "secret/data/*" {
 }
 `
 
-func addPolicy(client *vault.Client) error {
-	err := client.Sys().PutPolicy(policyName, policyDef)
+// addPolicy renders the policy if it is a template, validates it and writes
+// it to Vault
+func addPolicy(ctx context.Context, client *vault.Client, policy policySpec) error {
+	rules := policy.Rules
+	if policy.Template {
+		var err error
+		rules, err = renderPolicy(policy, authAccessor(ctx, client))
+		if err != nil {
+			return fmt.Errorf("policy %s: cannot render template: %w", policy.Name, err)
+		}
+	}
+	if _, err := parsePolicy(rules); err != nil {
+		return fmt.Errorf("policy %s: invalid rules: %w", policy.Name, err)
+	}
+	err := client.Sys().PutPolicyWithContext(ctx, policy.Name, rules)
 	if err != nil {
 		return err
 	}
-	log.Infof("k8s auth policy '%s' configured", policyName)
+	log.Infof("k8s auth policy '%s' configured", policy.Name)
+	events.jobEventf(corev1.EventTypeNormal, reasonPolicyWritten, "Wrote policy %s", policy.Name)
+	return nil
+}
+
+func deletePolicy(ctx context.Context, client *vault.Client, name string) error {
+	if err := client.Sys().DeletePolicyWithContext(ctx, name); err != nil {
+		return err
+	}
+	log.Infof("policy '%s' deleted", name)
+	events.jobEventf(corev1.EventTypeNormal, reasonPolicyDeleted, "Deleted policy %s", name)
 	return nil
 }
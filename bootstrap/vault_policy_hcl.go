@@ -0,0 +1,132 @@
+package bootstrap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// policyDoc is the part of a Vault ACL policy the tool checks
+type policyDoc struct {
+	Paths map[string]policyPath `hcl:"path"`
+}
+
+type policyPath struct {
+	Capabilities []string `hcl:"capabilities"`
+	// Policy is the deprecated shorthand for capabilities
+	Policy string `hcl:"policy"`
+}
+
+// policyCapabilities are the capabilities Vault accepts in a path stanza
+var policyCapabilities = map[string]bool{
+	"create": true, "read": true, "update": true, "patch": true, "delete": true,
+	"list": true, "sudo": true, "deny": true, "subscribe": true, "recover": true,
+}
+
+// policyShorthands are the accepted values of the deprecated policy key
+var policyShorthands = map[string]bool{
+	"deny": true, "read": true, "write": true, "sudo": true,
+}
+
+// policyPathKeys are the keys Vault accepts in a path stanza
+var policyPathKeys = map[string]bool{
+	"capabilities": true, "policy": true, "allowed_parameters": true, "denied_parameters": true,
+	"required_parameters": true, "min_wrapping_ttl": true, "max_wrapping_ttl": true,
+	"control_group": true, "mfa_methods": true, "subscribe_event_types": true,
+}
+
+// parsePolicy parses the rules of a policy like Vault does and rejects
+// policies without any path
+func parsePolicy(rules string) (*policyDoc, error) {
+	var doc policyDoc
+	if err := hcl.Decode(&doc, rules); err != nil {
+		return nil, err
+	}
+	if len(doc.Paths) == 0 {
+		return nil, fmt.Errorf("no path declared")
+	}
+	for path, p := range doc.Paths {
+		if len(p.Capabilities) == 0 && p.Policy == "" {
+			return nil, fmt.Errorf("path %q has no capabilities", path)
+		}
+	}
+	return &doc, nil
+}
+
+// lintPolicy checks the rules of a policy beyond what parsePolicy does.
+// Unknown keys and capabilities are errors, sudo and wildcards on sys/
+// paths are warnings.
+func lintPolicy(rules string) (errs []string, warnings []string) {
+	doc, err := parsePolicy(rules)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	// Keys are only visible in the syntax tree, Decode ignores unknown ones
+	file, err := hcl.Parse(rules)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	if root, ok := file.Node.(*ast.ObjectList); ok {
+		for _, item := range root.Items {
+			if key := item.Keys[0].Token.Value(); key != "path" && key != "name" {
+				errs = append(errs, fmt.Sprintf("%s: unknown key %v", item.Pos(), key))
+			}
+		}
+		for _, item := range root.Filter("path").Items {
+			obj, ok := item.Val.(*ast.ObjectType)
+			if !ok {
+				continue
+			}
+			for _, field := range obj.List.Items {
+				if key := fmt.Sprint(field.Keys[0].Token.Value()); !policyPathKeys[key] {
+					errs = append(errs, fmt.Sprintf("%s: unknown key %s in path %v", field.Pos(), key, item.Keys[0].Token.Value()))
+				}
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		p := doc.Paths[path]
+		sudo := p.Policy == "sudo"
+		if p.Policy != "" && !policyShorthands[p.Policy] {
+			errs = append(errs, fmt.Sprintf("path %q: unknown policy %q", path, p.Policy))
+		}
+		for _, c := range p.Capabilities {
+			if !policyCapabilities[c] {
+				errs = append(errs, fmt.Sprintf("path %q: unknown capability %q", path, c))
+			}
+			if c == "sudo" {
+				sudo = true
+			}
+		}
+		if sudo {
+			warnings = append(warnings, fmt.Sprintf("path %q grants sudo", path))
+		}
+		if broadSysPath(path) && !denyOnly(p) {
+			warnings = append(warnings, fmt.Sprintf("path %q grants access to all of sys/", path))
+		}
+	}
+	return errs, warnings
+}
+
+// broadSysPath reports whether a path glob covers all system backend paths
+func broadSysPath(path string) bool {
+	path = strings.TrimPrefix(path, "/")
+	return path == "*" || path == "+/*" || path == "sys*" || path == "sys/*" || path == "sys/+/*"
+}
+
+func denyOnly(p policyPath) bool {
+	if p.Policy != "" {
+		return p.Policy == "deny"
+	}
+	return len(p.Capabilities) == 1 && p.Capabilities[0] == "deny"
+}
@@ -0,0 +1,116 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// policyTemplateData holds the variables available to a policy template
+type policyTemplateData struct {
+	Mount     string
+	Namespace string
+	Cluster   string
+	Role      string
+}
+
+// renderPolicy executes the rules of a templated policy. Vault identity
+// templates use the same delimiters, so they are written with the helpers:
+//
+//	path "secret/data/{{ aliasMetadata "kubernetes" "service_account_namespace" }}/*" { ... }
+//
+// accessor returns the accessor of the auth method mounted at a path and
+// is only called when a template refers to an auth mount.
+func renderPolicy(policy policySpec, accessor func(mount string) (string, error)) (string, error) {
+	data := policyTemplateData{
+		Mount:     policy.Mount,
+		Namespace: policy.Namespace,
+		Cluster:   policy.Cluster,
+		Role:      policy.Role,
+	}
+	if data.Mount == "" {
+		data.Mount = "secret"
+	}
+	if data.Cluster == "" {
+		data.Cluster = vaultClusterName
+	}
+
+	funcs := template.FuncMap{
+		// identity renders an arbitrary Vault identity template
+		"identity": func(path string) string {
+			return "{{identity." + path + "}}"
+		},
+		"entityID": func() string {
+			return "{{identity.entity.id}}"
+		},
+		"entityName": func() string {
+			return "{{identity.entity.name}}"
+		},
+		"entityMetadata": func(key string) string {
+			return "{{identity.entity.metadata." + key + "}}"
+		},
+		"accessor": accessor,
+		// aliasName and aliasMetadata refer to the entity alias of the
+		// auth method mounted at mount
+		"aliasName": func(mount string) (string, error) {
+			a, err := accessor(mount)
+			if err != nil {
+				return "", err
+			}
+			return "{{identity.entity.aliases." + a + ".name}}", nil
+		},
+		"aliasMetadata": func(mount, key string) (string, error) {
+			a, err := accessor(mount)
+			if err != nil {
+				return "", err
+			}
+			return "{{identity.entity.aliases." + a + ".metadata." + key + "}}", nil
+		},
+		"groupName": func(id string) string {
+			return "{{identity.groups.ids." + id + ".name}}"
+		},
+	}
+
+	tmpl, err := template.New(policy.Name).Funcs(funcs).Option("missingkey=error").Parse(policy.Rules)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// errAuthNotEnabled is returned when a template refers to the accessor of an
+// auth method that is not enabled
+var errAuthNotEnabled = errors.New("auth method not enabled")
+
+// authAccessor returns a lookup of the accessors of the enabled auth
+// methods, read from Vault at most once
+func authAccessor(ctx context.Context, client *vault.Client) func(mount string) (string, error) {
+	var accessors map[string]string
+	return func(mount string) (string, error) {
+		if accessors == nil {
+			auths, err := client.Sys().ListAuthWithContext(ctx)
+			if err != nil {
+				return "", err
+			}
+			accessors = make(map[string]string, len(auths))
+			for path, auth := range auths {
+				accessors[path] = auth.Accessor
+			}
+		}
+		mount = strings.Trim(mount, "/") + "/"
+		a, ok := accessors[mount]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", errAuthNotEnabled, mount)
+		}
+		return a, nil
+	}
+}
@@ -1,38 +1,61 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 
 	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 )
 
-var saRoles = []vaultSaRole{
+var saRoles = []roleSpec{
 	{
-		name:        "external-secrets",
-		saName:      "external-secrets",
-		saNamespace: "external-secrets",
+		Name:                     "external-secrets",
+		ServiceAccountNames:      []string{"external-secrets"},
+		ServiceAccountNamespaces: []string{"external-secrets"},
 	},
 	{
-		name:        "argocd-repo-server",
-		saName:      "argocd-repo-server",
-		saNamespace: "argocd",
+		Name:                     "argocd-repo-server",
+		ServiceAccountNames:      []string{"argocd-repo-server"},
+		ServiceAccountNamespaces: []string{"argocd"},
 	},
 }
 
-func addRole(client *vault.Client, options *vaultSaRole) error {
-	path := fmt.Sprintf("auth/kubernetes/role/%s", options.name)
+// addRole writes a role of the kubernetes auth method mounted at authPath
+func addRole(ctx context.Context, client *vault.Client, authPath string, options *roleSpec) error {
+	path := fmt.Sprintf("auth/%s/role/%s", authPath, options.Name)
+	policies := options.Policies
+	if len(policies) == 0 {
+		policies = []string{policyName, "default"}
+	}
+	ttl := options.TTL
+	if ttl == "" {
+		ttl = "1h"
+	}
 	data := map[string]interface{}{
-		"bound_service_account_names":      options.saName,
-		"bound_service_account_namespaces": options.saNamespace,
-		"policies":                         []string{policyName, "default"},
-		"ttl":                              "1h",
+		"bound_service_account_names":      options.ServiceAccountNames,
+		"bound_service_account_namespaces": options.ServiceAccountNamespaces,
+		"policies":                         policies,
+		"ttl":                              ttl,
 	}
 
-	_, err = client.Logical().Write(path, data)
+	_, err := client.Logical().WriteWithContext(ctx, path, data)
 	if err != nil {
 		return err
 	}
-	log.Infof("k8s auth role '%s' configured", options.name)
+	log.Infof("k8s auth role '%s' configured on %s", options.Name, authPath)
+	events.jobEventf(corev1.EventTypeNormal, reasonRoleWritten, "Wrote k8s auth role %s on %s/", options.Name, authPath)
+	return nil
+}
+
+// deleteRole deletes a role of the kubernetes auth method mounted at authPath
+func deleteRole(ctx context.Context, client *vault.Client, authPath string, name string) error {
+	path := fmt.Sprintf("auth/%s/role/%s", authPath, name)
+	if _, err := client.Logical().DeleteWithContext(ctx, path); err != nil {
+		return err
+	}
+	log.Infof("k8s auth role '%s' deleted from %s", name, authPath)
+	events.jobEventf(corev1.EventTypeNormal, reasonRoleDeleted, "Deleted k8s auth role %s on %s/", name, authPath)
 	return nil
 }
@@ -1,29 +1,41 @@
 package bootstrap
 
 import (
+	"context"
+	"strings"
+
 	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
 )
 
-func checkSecretEngine(client *vault.Client) (bool, error) {
-	mounts, err := client.Logical().Read("sys/mounts")
+// path returns the mount path of the engine as listed in sys/mounts, with a
+// trailing slash
+func (m mountSpec) path() string {
+	return strings.Trim(m.Path, "/") + "/"
+}
+
+func checkSecretEngine(ctx context.Context, client *vault.Client, path string) (bool, error) {
+	path = strings.Trim(path, "/") + "/"
+	mounts, err := client.Logical().ReadWithContext(ctx, "sys/mounts")
 	if err != nil {
 		return false, err
 	}
-	if secret := mounts.Data["secret/"]; secret != nil {
-		log.Info("secret engine already enabled")
+	if secret := mounts.Data[path]; secret != nil {
+		log.Infof("secret engine %s already enabled", path)
 		return true, nil
 	}
 	return false, nil
 }
 
-func enableSecretEngine(client *vault.Client) error {
-	err := client.Sys().Mount("secret/", &vault.MountInput{
-		Type: "kv-v2",
+func enableSecretEngine(ctx context.Context, client *vault.Client, mount mountSpec) error {
+	err := client.Sys().MountWithContext(ctx, mount.path(), &vault.MountInput{
+		Type:        mount.Type,
+		Description: mount.Description,
+		Options:     mount.Options,
 	})
 	if err != nil {
 		return err
 	}
-	log.Info("secret engine successfully enabled")
+	log.Infof("secret engine %s successfully enabled", mount.path())
 	return nil
 }
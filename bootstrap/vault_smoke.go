@@ -0,0 +1,162 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	vault "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// smokeTokenExpiration is the shortest lifetime the TokenRequest API allows
+const smokeTokenExpiration = 600
+
+// smokeResult is the outcome of the smoke test of one role
+type smokeResult struct {
+	role           string
+	serviceAccount string
+	err            error
+}
+
+// smokeTest logs in as a ServiceAccount bound to every role of the spec and
+// checks the capabilities the role declares. It fails if any role fails.
+// Roles of remote clusters, ServiceAccounts and tenants are not tested.
+func smokeTest(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, roles []roleSpec) error {
+	var results []smokeResult
+	var errs []error
+	for _, role := range roles {
+		result := smokeTestRole(ctx, client, clientsetK8s, role)
+		results = append(results, result)
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("role %s: %w", role.Name, result.err))
+			events.jobEventf(corev1.EventTypeWarning, reasonSmokeTestFailed, "Smoke test of role %s failed: %s", role.Name, result.err.Error())
+		} else {
+			events.jobEventf(corev1.EventTypeNormal, reasonSmokeTestPassed, "Smoke test of role %s passed", role.Name)
+		}
+	}
+	logSmokeResults(results)
+	return errors.Join(errs...)
+}
+
+func smokeTestRole(ctx context.Context, client *vault.Client, clientsetK8s kubernetes.Interface, role roleSpec) smokeResult {
+	result := smokeResult{role: role.Name}
+	saName, saNamespace := firstBound(role.ServiceAccountNames), firstBound(role.ServiceAccountNamespaces)
+	if saName == "" || saNamespace == "" {
+		result.err = fmt.Errorf("no ServiceAccount to log in as, only wildcards are bound")
+		return result
+	}
+	result.serviceAccount = saNamespace + "/" + saName
+
+	expiration := int64(smokeTokenExpiration)
+	tr, err := clientsetK8s.CoreV1().ServiceAccounts(saNamespace).CreateToken(ctx, saName, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expiration},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		result.err = fmt.Errorf("cannot request token: %w", err)
+		return result
+	}
+
+	roleClient, err := client.Clone()
+	if err != nil {
+		result.err = err
+		return result
+	}
+	roleClient.ClearToken()
+	login, err := roleClient.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/login", vaultK8sAuthPath), map[string]interface{}{
+		"role": role.Name,
+		"jwt":  tr.Status.Token,
+	})
+	if err != nil {
+		result.err = fmt.Errorf("login failed: %w", err)
+		return result
+	}
+	if login == nil || login.Auth == nil {
+		result.err = fmt.Errorf("login returned no token")
+		return result
+	}
+	roleClient.SetToken(login.Auth.ClientToken)
+	// The token is only needed for this check
+	defer func() {
+		if err := roleClient.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+			log.Warnf("smoke test: cannot revoke token of role %s: %s", role.Name, err.Error())
+		}
+	}()
+
+	result.err = checkCapabilities(ctx, roleClient, role.Checks)
+	return result
+}
+
+// checkCapabilities compares the capabilities of the client token on every
+// checked path with the expected ones
+func checkCapabilities(ctx context.Context, client *vault.Client, checks []capabilityCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(checks))
+	for _, check := range checks {
+		paths = append(paths, check.Path)
+	}
+	secret, err := client.Logical().WriteWithContext(ctx, "sys/capabilities-self", map[string]interface{}{
+		"paths": paths,
+	})
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return fmt.Errorf("sys/capabilities-self returned nothing")
+	}
+
+	var errs []error
+	for _, check := range checks {
+		granted := map[string]bool{}
+		if caps, ok := secret.Data[check.Path].([]interface{}); ok {
+			for _, c := range caps {
+				granted[fmt.Sprint(c)] = true
+			}
+		}
+		var missing []string
+		for _, c := range check.Capabilities {
+			if !granted[c] && !granted["root"] {
+				missing = append(missing, c)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("%s: missing %s", check.Path, strings.Join(missing, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// firstBound returns the first bound name that is not a wildcard
+func firstBound(names []string) string {
+	for _, name := range names {
+		if !strings.Contains(name, "*") {
+			return name
+		}
+	}
+	return ""
+}
+
+func logSmokeResults(results []smokeResult) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tSERVICE ACCOUNT\tRESULT")
+	for _, r := range results {
+		outcome := "PASS"
+		if r.err != nil {
+			outcome = "FAIL: " + strings.ReplaceAll(r.err.Error(), "\n", "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.role, r.serviceAccount, outcome)
+	}
+	w.Flush()
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		log.Info(line)
+	}
+}
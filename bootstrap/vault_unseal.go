@@ -1,14 +1,17 @@
 package bootstrap
 
 import (
+	"context"
+	"fmt"
 	"strconv"
 
 	vault "github.com/hashicorp/vault/api"
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 )
 
-func checkUnseal(client *vault.Client) (bool, error) {
-	sealed, err := client.Sys().SealStatus()
+func checkUnseal(ctx context.Context, client *vault.Client) (bool, error) {
+	sealed, err := client.Sys().SealStatusWithContext(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -18,40 +21,62 @@ func checkUnseal(client *vault.Client) (bool, error) {
 	return true, nil
 }
 
-func unsealMember(pod vaultPod, unsealKeys []string) bool {
-	unsealed, err := checkUnseal(pod.client)
+// unsealMember unseals the member if it is sealed and reports whether
+// any unseal keys were submitted
+func unsealMember(ctx context.Context, pod vaultPod, unsealKeys []string) (bool, error) {
+	unsealed, err := checkUnseal(ctx, pod.client)
 	if err != nil {
-		log.Errorf(err.Error())
-		return false
+		return false, fmt.Errorf("%s: %w", pod.name, err)
 	}
 	if unsealed {
 		log.Infof("%s: Vault already unsealed", pod.name)
-		return false
-	} else {
-		shamirUnseal(pod, unsealKeys)
-		return true
+		runReport.addStep(reasonUnsealed, pod.name, stepSkipped, "Vault already unsealed")
+		return false, nil
+	}
+	if err := shamirUnseal(ctx, pod, unsealKeys); err != nil {
+		return true, err
 	}
+	return true, nil
 }
 
-// Unseal Vault using Shamir keys
-func shamirUnseal(pod vaultPod, unsealKeys []string) {
-	var err error
+// Unseal Vault using Shamir keys. Keys are submitted until the threshold
+// reported by Vault is reached.
+func shamirUnseal(ctx context.Context, pod vaultPod, unsealKeys []string) error {
 	var sealStatus *vault.SealStatusResponse
-out:
-	for {
+	attempt := 0
+	err := retry(ctx, pod.name+": unseal", func(ctx context.Context) (bool, error) {
+		var err error
 		log.Infof("%s: Starting unsealing", pod.name)
+		if attempt++; attempt > 1 {
+			// Discard the progress of the failed attempt
+			if _, err = pod.client.Sys().UnsealWithOptionsWithContext(ctx, &vault.UnsealOpts{Reset: true}); err != nil {
+				return false, err
+			}
+		}
 		// Loop through the keys and unseal
-		for j := 0; j < vaultKeyThreshold; j++ {
-			sealStatus, err = pod.client.Sys().Unseal(unsealKeys[j])
+		for _, key := range unsealKeys {
+			sealStatus, err = pod.client.Sys().UnsealWithContext(ctx, key)
 			if err != nil {
 				log.Infof("%s: %s", pod.name, err.Error())
-				continue out
+				return false, err
+			}
+			if !sealStatus.Sealed {
+				break
 			}
-			log.Infof("%s: Unseal progress %s/%s", pod.name, strconv.Itoa(sealStatus.Progress), strconv.Itoa(vaultKeyThreshold))
+			log.Infof("%s: Unseal progress %s/%s", pod.name, strconv.Itoa(sealStatus.Progress), strconv.Itoa(sealStatus.T))
 		}
-		break
+		return true, nil
+	})
+	if err != nil {
+		err = fmt.Errorf("%s: unseal failed: %w", pod.name, err)
+	} else if sealStatus == nil || sealStatus.Sealed {
+		err = fmt.Errorf("%s: still sealed after submitting %d keys", pod.name, len(unsealKeys))
 	}
-	if !sealStatus.Sealed {
-		log.Infof("%s: Vault was successfully unsealed using Shamir keys", pod.name)
+	if err != nil {
+		events.podEventf(pod.name, corev1.EventTypeWarning, reasonUnsealFailed, "%s", err.Error())
+		return err
 	}
+	log.Infof("%s: Vault was successfully unsealed using Shamir keys", pod.name)
+	events.podEventf(pod.name, corev1.EventTypeNormal, reasonUnsealed, "Vault unsealed using Shamir keys")
+	return nil
 }
@@ -1,26 +1,43 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spirkaa/vault-bootstrap/bootstrap"
 )
 
 func main() {
-	runningMode := flag.String("mode", "job", "running mode: job or init-container")
+	runningMode := flag.String("mode", "job", "running mode: job, init-container, sidecar, controller or validate")
 	flag.Parse()
+
+	// Stop waiting as soon as Kubernetes terminates the pod
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	if *runningMode == "job" {
 		log.Info("Running in job mode...")
-		bootstrap.Run()
+		bootstrap.Run(ctx)
 	} else if *runningMode == "init-container" {
 		log.Info("Running in init-container mode...")
-		bootstrap.InitContainer()
+		bootstrap.InitContainer(ctx)
+	} else if *runningMode == "sidecar" {
+		log.Info("Running in sidecar mode...")
+		bootstrap.Sidecar(ctx)
+	} else if *runningMode == "controller" {
+		log.Info("Running in controller mode...")
+		bootstrap.Controller(ctx)
+	} else if *runningMode == "validate" {
+		log.Info("Running in validate mode...")
+		bootstrap.Validate(ctx)
 	} else {
-		panic("Running mode must be 'sidecar' or 'job'")
+		panic("Running mode must be 'job', 'init-container', 'sidecar', 'controller' or 'validate'")
 	}
 }
 
@@ -42,4 +59,5 @@ func init() {
 
 	log.Info("LogLevel set to " + level.String())
 	log.Info(runtime.Version())
+	log.Info("vault-bootstrap " + bootstrap.Version)
 }